@@ -22,6 +22,7 @@ type cliConfig struct {
 	DataFolder          string `yaml:"data_folder"`
 	SimulationCfgPath   string `yaml:"simulation_path,omitempty"`
 	SimulationCfg       *csconfig.SimulationConfig
+	EnrichCfg           *csconfig.EnrichersConfig
 }
 
 func NewConfigCmd() *cobra.Command {
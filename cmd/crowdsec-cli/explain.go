@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/parser"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/enescakir/emoji"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type explainNode struct {
+	Stage         string   `json:"stage"`
+	Node          string   `json:"node"`
+	FilterMatched bool     `json:"filter_matched"`
+	Success       bool     `json:"success"`
+	Dropped       bool     `json:"dropped,omitempty"`
+	Changes       []string `json:"changes,omitempty"`
+}
+
+type explainResult struct {
+	Line            string        `json:"line"`
+	Nodes           []explainNode `json:"nodes"`
+	Process         bool          `json:"process"`
+	Stage           string        `json:"stage"`
+	Whitelisted     bool          `json:"whitelisted"`
+	WhitelistReason string        `json:"whitelist_reason,omitempty"`
+	Scenarios       []string      `json:"scenarios"`
+}
+
+//diffEvent lists what a node changed in the event
+func diffEvent(before types.Event, after types.Event) []string {
+	var changes []string
+
+	changes = append(changes, diffFields("Parsed", before.Parsed, after.Parsed)...)
+	changes = append(changes, diffFields("Meta", before.Meta, after.Meta)...)
+	changes = append(changes, diffFields("Enriched", before.Enriched, after.Enriched)...)
+	var beforeTypes, afterTypes map[string]string
+	if before.Typed != nil {
+		beforeTypes = before.Typed.Types
+	}
+	if after.Typed != nil {
+		afterTypes = after.Typed.Types
+	}
+	changes = append(changes, diffFields("Types", beforeTypes, afterTypes)...)
+	if after.Whitelisted && !before.Whitelisted {
+		changes = append(changes, fmt.Sprintf("whitelisted : %s", after.WhiteListReason))
+	}
+	if after.Stage != before.Stage && after.Stage != "" && before.Stage != "" {
+		changes = append(changes, fmt.Sprintf("stage : %s -> %s", before.Stage, after.Stage))
+	}
+	return changes
+}
+
+func diffFields(label string, before map[string]string, after map[string]string) []string {
+	var changes []string
+
+	keys := make(map[string]bool)
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		oldval, oldok := before[k]
+		newval, newok := after[k]
+		switch {
+		case !oldok:
+			changes = append(changes, fmt.Sprintf("+ %s[%s] : '%s'", label, k, newval))
+		case !newok:
+			changes = append(changes, fmt.Sprintf("- %s[%s]", label, k))
+		case oldval != newval:
+			changes = append(changes, fmt.Sprintf("~ %s[%s] : '%s' -> '%s'", label, k, oldval, newval))
+		}
+	}
+	return changes
+}
+
+func explainLine(pctx *parser.UnixParserCtx, nodes []parser.Node, holders []leaky.BucketFactory, buckets *leaky.Buckets, evt types.Event) (explainResult, error) {
+	result := explainResult{Line: evt.Line.Raw, Scenarios: []string{}}
+
+	parsed, err := parser.Parse(*pctx, evt, nodes)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse '%s' : %s", evt.Line.Raw, err)
+	}
+	previous := evt
+	for _, trace := range parser.ParseTrace {
+		node := explainNode{
+			Stage:         trace.Stage,
+			Node:          trace.Node,
+			FilterMatched: trace.FilterMatched,
+			Success:       trace.Success,
+			Dropped:       trace.Dropped,
+		}
+		if trace.FilterMatched {
+			node.Changes = diffEvent(previous, trace.Event)
+			previous = trace.Event
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+	result.Process = parsed.Process
+	result.Stage = parsed.Stage
+	result.Whitelisted = parsed.Whitelisted
+	result.WhitelistReason = parsed.WhiteListReason
+	if !parsed.Process || parsed.Whitelisted {
+		return result, nil
+	}
+
+	leaky.BucketPourCache = nil
+	if _, err := leaky.PourItemToHolders(parsed, holders, buckets); err != nil {
+		return result, fmt.Errorf("failed to pour '%s' : %s", evt.Line.Raw, err)
+	}
+	for _, holder := range holders {
+		if _, ok := leaky.BucketPourCache[holder.Name]; ok {
+			result.Scenarios = append(result.Scenarios, holder.Name)
+		}
+	}
+	return result, nil
+}
+
+func printExplain(result explainResult, verbose bool) {
+	fmt.Printf("line: %s\n", result.Line)
+	stage := ""
+	for _, node := range result.Nodes {
+		if !node.FilterMatched && !verbose {
+			continue
+		}
+		if node.Stage != stage {
+			stage = node.Stage
+			fmt.Printf("\t%s\n", stage)
+		}
+		status := emoji.CrossMark
+		if node.Success {
+			status = emoji.CheckMarkButton
+		}
+		switch {
+		case !node.FilterMatched:
+			fmt.Printf("\t\t%v %s (filter didn't match)\n", status, node.Node)
+		case node.Dropped:
+			fmt.Printf("\t\t%v %s (event dropped)\n", status, node.Node)
+		default:
+			fmt.Printf("\t\t%v %s\n", status, node.Node)
+		}
+		for _, change := range node.Changes {
+			fmt.Printf("\t\t\t%s\n", change)
+		}
+	}
+	switch {
+	case !result.Process:
+		fmt.Printf("\t%v parsing failed at stage %s\n", emoji.CrossMark, result.Stage)
+	case result.Whitelisted:
+		fmt.Printf("\t%v whitelisted : %s\n", emoji.CheckMarkButton, result.WhitelistReason)
+	case len(result.Scenarios) == 0:
+		fmt.Printf("\t%v no scenario matched\n", emoji.CrossMark)
+	default:
+		fmt.Printf("\tscenarios\n")
+		for _, scenario := range result.Scenarios {
+			fmt.Printf("\t\t%v %s\n", emoji.CheckMarkButton, scenario)
+		}
+	}
+}
+
+func runExplain(lines []string, source string, logType string, verbose bool) error {
+	pctx, nodes, err := loadParsers(config.InstallFolder + "/parsers/")
+	if err != nil {
+		return err
+	}
+	holders, outputEventChan, err := leaky.Init(map[string]string{"patterns": config.InstallFolder + "/scenarios/", "data": config.DataFolder})
+	if err != nil {
+		return fmt.Errorf("failed to load scenarios : %s", err)
+	}
+	//overflows aren't of interest here
+	go func() {
+		for range outputEventChan {
+		}
+	}()
+	buckets := leaky.NewBuckets()
+
+	parser.ParseDump = true
+	leaky.BucketPourTrack = true
+	var results []explainResult
+	for _, line := range lines {
+		evt := types.Event{
+			Type:       types.LOG,
+			Process:    true,
+			ExpectMode: leaky.LIVE,
+			Line: types.Line{
+				Raw:     line,
+				Src:     source,
+				Labels:  map[string]string{"type": logType},
+				Process: true,
+			},
+		}
+		result, err := explainLine(pctx, nodes, holders, buckets, evt)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	if config.output == "json" {
+		x, err := json.MarshalIndent(results, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal results : %s", err)
+		}
+		fmt.Printf("%s\n", x)
+		return nil
+	}
+	for _, result := range results {
+		printExplain(result, verbose)
+	}
+	return nil
+}
+
+func readLines(file string) ([]string, error) {
+	var lines []string
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func NewExplainCmd() *cobra.Command {
+	var logLine string
+	var logFile string
+	var logType string
+	var verbose bool
+
+	var cmdExplain = &cobra.Command{
+		Use:   "explain",
+		Short: "Explain how a log line is processed by the parsers and scenarios",
+		Long: `Run a log line (or the lines of a file) through the installed parsers and scenarios, and show :
+
+- the nodes of each stage that succeeded or failed
+- what each node changed in evt.Parsed, evt.Meta and evt.Enriched
+- the whitelist decisions
+- the scenarios whose filter matched the parsed event`,
+		Example: `cscli explain --log "Sep 19 18:33:22 host sshd[1234]: Invalid user test from 1.2.3.4 port 53000" --type syslog
+cscli explain --file ./sample.log --type nginx`,
+		Args: cobra.ExactArgs(0),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !config.configured {
+				return fmt.Errorf("you must configure cli before explaining log lines")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var lines []string
+
+			if (logLine == "") == (logFile == "") {
+				log.Fatalf("please provide either --log or --file")
+			}
+			if logType == "" {
+				log.Fatalf("please provide the --type of the log")
+			}
+			source := "cscli"
+			if logFile != "" {
+				var err error
+				lines, err = readLines(logFile)
+				if err != nil {
+					log.Fatalf("failed to read %s : %s", logFile, err)
+				}
+				source = logFile
+			} else {
+				lines = []string{logLine}
+			}
+			if err := runExplain(lines, source, logType, verbose); err != nil {
+				log.Fatalf("%s", err)
+			}
+		},
+	}
+	cmdExplain.Flags().StringVarP(&logLine, "log", "l", "", "Log line to explain")
+	cmdExplain.Flags().StringVarP(&logFile, "file", "f", "", "File of log lines to explain")
+	cmdExplain.Flags().StringVarP(&logType, "type", "t", "", "Type of the log (as the 'type' label of the acquisition)")
+	cmdExplain.Flags().BoolVarP(&verbose, "verbose", "v", false, "Also show the nodes whose filter didn't match")
+	return cmdExplain
+}
@@ -65,6 +65,7 @@ func initConfig() {
 	config.configured = true
 	config.SimulationCfg = csConfig.SimulationCfg
 	config.SimulationCfgPath = csConfig.SimulationCfgPath
+	config.EnrichCfg = csConfig.Enrich
 }
 
 func main() {
@@ -145,6 +146,8 @@ API interaction:
 	rootCmd.AddCommand(NewDashboardCmd())
 	rootCmd.AddCommand(NewInspectCmd())
 	rootCmd.AddCommand(NewSimulationCmds())
+	rootCmd.AddCommand(NewTestCmd())
+	rootCmd.AddCommand(NewExplainCmd())
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalf("While executing root command : %s", err)
 	}
@@ -80,6 +80,7 @@ func ShowPrometheus(url string) {
 	acquis_stats := map[string]map[string]int{}
 	parsers_stats := map[string]map[string]int{}
 	buckets_stats := map[string]map[string]int{}
+	geoip_stats := map[string]map[string]string{}
 	for idx, fam := range result {
 		if !strings.HasPrefix(fam.Name, "cs_") {
 			continue
@@ -163,6 +164,17 @@ func ShowPrometheus(url string) {
 					parsers_stats[name] = make(map[string]int)
 				}
 				parsers_stats[name]["unparsed"] += ival
+				/*enrichers*/
+			case "cs_geoip_database_info":
+				loaded := "no"
+				if ival == 1 {
+					loaded = "yes"
+				}
+				geoip_stats[metric.Labels["database"]] = map[string]string{
+					"loaded":     loaded,
+					"type":       metric.Labels["type"],
+					"build_date": metric.Labels["build_date"],
+				}
 			default:
 				continue
 			}
@@ -191,12 +203,28 @@ func ShowPrometheus(url string) {
 			log.Warningf("while collecting acquis stats : %s", err)
 		}
 
+		geoipTable := tablewriter.NewWriter(os.Stdout)
+		geoipTable.SetHeader([]string{"GeoIP database", "Loaded", "Type", "Build date"})
+		databases := []string{}
+		for database := range geoip_stats {
+			databases = append(databases, database)
+		}
+		sort.Strings(databases)
+		for _, database := range databases {
+			stats := geoip_stats[database]
+			geoipTable.Append([]string{database, stats["loaded"], stats["type"], stats["build_date"]})
+		}
+
 		log.Printf("Buckets Metrics:")
 		bucketsTable.Render()
 		log.Printf("Acquisition Metrics:")
 		acquisTable.Render()
 		log.Printf("Parser Metrics:")
 		parsersTable.Render()
+		if len(geoip_stats) > 0 {
+			log.Printf("GeoIP Metrics:")
+			geoipTable.Render()
+		}
 	} else if config.output == "json" {
 		for _, val := range []map[string]map[string]int{acquis_stats, parsers_stats, buckets_stats} {
 			x, err := json.MarshalIndent(val, "", " ")
@@ -205,6 +233,11 @@ func ShowPrometheus(url string) {
 			}
 			fmt.Printf("%s\n", string(x))
 		}
+		x, err := json.MarshalIndent(geoip_stats, "", " ")
+		if err != nil {
+			log.Fatalf("failed to unmarshal metrics : %v", err)
+		}
+		fmt.Printf("%s\n", string(x))
 	} else if config.output == "raw" {
 		for _, val := range []map[string]map[string]int{acquis_stats, parsers_stats, buckets_stats} {
 			x, err := yaml.Marshal(val)
@@ -213,6 +246,11 @@ func ShowPrometheus(url string) {
 			}
 			fmt.Printf("%s\n", string(x))
 		}
+		x, err := yaml.Marshal(geoip_stats)
+		if err != nil {
+			log.Fatalf("failed to unmarshal metrics : %v", err)
+		}
+		fmt.Printf("%s\n", string(x))
 	}
 }
 
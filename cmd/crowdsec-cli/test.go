@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
+	"github.com/crowdsecurity/crowdsec/pkg/exprhelpers"
+	"github.com/crowdsecurity/crowdsec/pkg/parser"
+	"github.com/enescakir/emoji"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type parserTestReport struct {
+	File string `json:"file"`
+	parser.ParserTestResult
+}
+
+//loadParsers loads the parsers of dir the way crowdsec does, with the patterns and enrichers of the installation
+func loadParsers(dir string) (*parser.UnixParserCtx, []parser.Node, error) {
+	var p parser.UnixParser
+
+	if err := exprhelpers.Init(); err != nil {
+		return nil, nil, fmt.Errorf("failed to init expr helpers : %s", err)
+	}
+	pctx, err := p.Init(map[string]interface{}{"patterns": config.InstallFolder + "/patterns/", "data": config.DataFolder})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load parser patterns : %s", err)
+	}
+	enrichCfg := csconfig.EnrichersConfig{}
+	if config.EnrichCfg != nil {
+		enrichCfg = *config.EnrichCfg
+	}
+	parser.ECTX, err = parser.LoadEnrichers(enrichCfg, config.DataFolder)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load enrichers : %s", err)
+	}
+	nodes, err := parser.LoadStageDir(dir, pctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load parsers from %s : %s", dir, err)
+	}
+	return pctx, nodes, nil
+}
+
+//testFiles returns the yaml files of the given files and directories
+func testFiles(args []string) ([]string, error) {
+	var files []string
+
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func runParserTests(parsersDir string, args []string) error {
+	files, err := testFiles(args)
+	if err != nil {
+		return fmt.Errorf("while listing test files : %s", err)
+	}
+	pctx, nodes, err := loadParsers(parsersDir)
+	if err != nil {
+		return err
+	}
+
+	var reports []parserTestReport
+	failed := 0
+	for _, file := range files {
+		tests, err := parser.LoadParserTests(file)
+		if err != nil {
+			return err
+		}
+		for _, test := range tests {
+			result, err := parser.RunParserTest(*pctx, nodes, test)
+			if err != nil {
+				return fmt.Errorf("%s : %s", file, err)
+			}
+			if !result.Success() {
+				failed++
+			}
+			reports = append(reports, parserTestReport{File: file, ParserTestResult: result})
+		}
+	}
+
+	if config.output == "json" {
+		x, err := json.MarshalIndent(reports, "", " ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal results : %s", err)
+		}
+		fmt.Printf("%s\n", x)
+	} else {
+		for _, report := range reports {
+			if report.Success() {
+				fmt.Printf("%v %s : %s\n", emoji.CheckMarkButton, report.File, report.Name)
+				continue
+			}
+			fmt.Printf("%v %s : %s\n", emoji.CrossMark, report.File, report.Name)
+			for _, diff := range report.Diffs {
+				fmt.Printf("\t%s\n", diff)
+			}
+		}
+		fmt.Printf("%d/%d tests passed\n", len(reports)-failed, len(reports))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d tests failed", failed, len(reports))
+	}
+	return nil
+}
+
+func NewTestCmd() *cobra.Command {
+	var parsersDir string
+
+	var cmdTest = &cobra.Command{
+		Use:   "test [type]",
+		Short: "Test configurations against sample logs",
+		Args:  cobra.MinimumNArgs(1),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !config.configured {
+				return fmt.Errorf("you must configure cli before testing configurations")
+			}
+			return nil
+		},
+	}
+
+	var cmdTestParsers = &cobra.Command{
+		Use:   "parsers <test_file|test_dir>...",
+		Short: "Test parsers",
+		Long: `Run the sample lines of the test files through the parsers, and report the differences with the expected results.
+
+A test file is a list of test cases :
+
+- name: ssh failed password
+  line: "Jan 12 10:11:12 host sshd[123]: Failed password for root from 1.2.3.4 port 22 ssh2"
+  labels:
+    type: syslog
+  expected:
+    stage: s02-enrich
+    meta:
+      log_type: ssh_failed-auth
+      source_ip: 1.2.3.4
+
+Only the fields present in 'expected' are checked, and the line is expected to be parsed unless 'process: false' is set.
+The types of the typed entries can be checked with 'types' (ie. 'Parsed.status: int').
+The command fails if any test fails.`,
+		Example: `cscli test parsers ./tests/
+cscli test parsers --parsers ./my-parsers/ ./tests/sshd.yaml`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if parsersDir == "" {
+				parsersDir = config.InstallFolder + "/parsers/"
+			}
+			if err := runParserTests(parsersDir, args); err != nil {
+				log.Fatalf("%s", err)
+			}
+		},
+	}
+	cmdTestParsers.Flags().StringVar(&parsersDir, "parsers", "", "Directory of the parsers to test, organized by stage (default: the installed parsers)")
+	cmdTest.AddCommand(cmdTestParsers)
+	return cmdTest
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"syscall"
 
+	"net/http"
 	_ "net/http/pprof"
 	"time"
 
@@ -29,10 +30,11 @@ var (
 	parsersTomb tomb.Tomb
 	bucketsTomb tomb.Tomb
 	outputsTomb tomb.Tomb
+	replayTomb  tomb.Tomb
 	/*global crowdsec config*/
 	cConfig *csconfig.CrowdSec
 	/*the state of acquisition*/
-	acquisitionCTX *acquisition.FileAcquisCtx
+	acquisitionCTX *acquisition.AcquisCtx
 	/*the state of the buckets*/
 	holders         []leaky.BucketFactory
 	buckets         *leaky.Buckets
@@ -45,6 +47,8 @@ var (
 	postOverflowCTX   *parser.UnixParserCtx
 	parserNodes       []parser.Node
 	postOverflowNodes []parser.Node
+	/*where the lines no parser understood go, if enabled*/
+	unparsedSink *parser.UnparsedSink
 	/*settings*/
 	lastProcessedItem time.Time /*keep track of last item timestamp in time-machine. it is used to GC buckets when we dump them.*/
 )
@@ -71,11 +75,16 @@ func LoadParsers(cConfig *csconfig.CrowdSec) error {
 		Load enrichers
 	*/
 	log.Infof("Loading enrich plugins")
-	parserPlugins, err := parser.Loadplugin(cConfig.DataFolder)
+	enrichCfg := csconfig.EnrichersConfig{}
+	if cConfig.Enrich != nil {
+		enrichCfg = *cConfig.Enrich
+	}
+	//on reload, the previous enrichers are released first
+	parser.CloseEnrichers(parser.ECTX)
+	parser.ECTX, err = parser.LoadEnrichers(enrichCfg, cConfig.DataFolder)
 	if err != nil {
 		return fmt.Errorf("Failed to load enrich plugin : %v", err)
 	}
-	parser.ECTX = []parser.EnricherCtx{parserPlugins}
 
 	/*
 	 Load the actual parsers
@@ -153,8 +162,8 @@ func LoadOutputs(cConfig *csconfig.CrowdSec) error {
 		return fmt.Errorf("Failed to load output profiles : %v", err)
 	}
 
-	//If the user is providing a single file (ie forensic mode), don't flush expired records
-	if cConfig.SingleFile != "" {
+	//If the user is providing a single file (ie forensic mode), don't flush expired records, unless it's replayed live
+	if cConfig.SingleFile != "" && !cConfig.Replay {
 		log.Infof("forensic mode, disable flush")
 		cConfig.OutputConfig.Flush = false
 	} else {
@@ -199,14 +208,29 @@ func StartProcessingRoutines(cConfig *csconfig.CrowdSec) (chan types.Event, erro
 	parsersTomb = tomb.Tomb{}
 	bucketsTomb = tomb.Tomb{}
 	outputsTomb = tomb.Tomb{}
+	replayTomb = tomb.Tomb{}
 
 	inputLineChan := make(chan types.Event)
 	inputEventChan := make(chan types.Event)
+	parsedChan := inputEventChan
+
+	//in replay mode, the parsed events are paced before being poured
+	if cConfig.Replay {
+		parsedChan = make(chan types.Event)
+		if cConfig.ReplaySpeed == 0 {
+			log.Infof("replaying %s in live mode as fast as possible", cConfig.SingleFile)
+		} else {
+			log.Infof("replaying %s in live mode at %gx", cConfig.SingleFile, cConfig.ReplaySpeed)
+		}
+		replayTomb.Go(func() error {
+			return runReplay(parsedChan, inputEventChan, cConfig.ReplaySpeed)
+		})
+	}
 
 	//start go-routines for parsing, buckets pour and ouputs.
 	for i := 0; i < cConfig.NbParsers; i++ {
 		parsersTomb.Go(func() error {
-			err := runParse(inputLineChan, inputEventChan, *parserCTX, parserNodes)
+			err := runParse(inputLineChan, parsedChan, *parserCTX, parserNodes)
 			if err != nil {
 				log.Errorf("runParse error : %s", err)
 				return err
@@ -279,6 +303,20 @@ func main() {
 		registerPrometheus(cConfig.PrometheusMode)
 		cConfig.Profiling = true
 	}
+	if cConfig.Unparsed != nil {
+		if unparsedSink, err = parser.NewUnparsedSink(*cConfig.Unparsed); err != nil {
+			log.Fatalf("Failed to create unparsed lines sink : %s", err)
+		}
+		//the lines kept in memory are served on their own listener, without authentication
+		if cConfig.Unparsed.Mode == csconfig.UNPARSEDMEMORY {
+			mux := http.NewServeMux()
+			mux.Handle("/unparsed", unparsedSink)
+			go func() {
+				log.Infof("Serving unparsed lines on http://%s/unparsed", cConfig.Unparsed.Listen)
+				log.Fatal(http.ListenAndServe(cConfig.Unparsed.Listen, mux))
+			}()
+		}
+	}
 	if cConfig.Profiling {
 		go runTachymeter(cConfig.HTTPListen)
 	}
@@ -132,14 +132,18 @@ func registerPrometheus(mode string) {
 	if mode == "aggregated" {
 		log.Infof("Loading aggregated prometheus collectors")
 		prometheus.MustRegister(globalParserHits, globalParserHitsOk, globalParserHitsKo,
-			acquisition.ReaderHits, globalCsInfo,
+			acquisition.ReaderHits, acquisition.TailedFiles, acquisition.HTTPRejected, globalCsInfo,
+			acquisition.ReaderQueueDepth, acquisition.ReaderDropped, acquisition.ReaderLag,
 			leaky.BucketsUnderflow, leaky.BucketsInstanciation, leaky.BucketsOverflow,
-			leaky.BucketsCurrentCount)
+			leaky.BucketsCurrentCount, parser.EnricherHealthy, parser.EnricherErrors, parser.ReverseDnsCacheHits, parser.ReverseDnsCacheMisses,
+			parser.GeoIpDatabaseInfo)
 	} else {
 		log.Infof("Loading prometheus collectors")
 		prometheus.MustRegister(globalParserHits, globalParserHitsOk, globalParserHitsKo,
-			parser.NodesHits, parser.NodesHitsOk, parser.NodesHitsKo,
-			acquisition.ReaderHits, globalCsInfo,
+			parser.NodesHits, parser.NodesHitsOk, parser.NodesHitsKo, parser.EnricherHealthy, parser.EnricherErrors,
+			parser.ReverseDnsCacheHits, parser.ReverseDnsCacheMisses, parser.GeoIpDatabaseInfo,
+			acquisition.ReaderHits, acquisition.TailedFiles, acquisition.HTTPRejected, globalCsInfo,
+			acquisition.ReaderQueueDepth, acquisition.ReaderDropped, acquisition.ReaderLag,
 			leaky.BucketsPour, leaky.BucketsUnderflow, leaky.BucketsInstanciation, leaky.BucketsOverflow, leaky.BucketsCurrentCount)
 
 	}
@@ -48,6 +48,9 @@ LOOP:
 					atomic.AddUint64(&linesParsedKO, 1)
 				}
 				globalParserHitsKo.With(prometheus.Labels{"source": event.Line.Src}).Inc()
+				if unparsedSink != nil {
+					unparsedSink.Add(event, parsed.Stage)
+				}
 				log.Debugf("Discarding line %+v", parsed)
 				discardCPT++
 				continue
@@ -31,8 +31,8 @@ LOOP:
 
 			if count%5000 == 0 {
 				log.Warningf("%d existing LeakyRoutine", leaky.LeakyRoutineCount)
-				//when in forensics mode, garbage collect buckets
-				if parsed.MarshaledTime != "" && cConfig.SingleFile != "" {
+				//when in forensics mode, garbage collect buckets (replayed events are live ones)
+				if parsed.MarshaledTime != "" && cConfig.SingleFile != "" && !cConfig.Replay {
 					var z *time.Time = &time.Time{}
 					if err := z.UnmarshalText([]byte(parsed.MarshaledTime)); err != nil {
 						log.Warningf("Failed to unmarshal time from event '%s' : %s", parsed.MarshaledTime, err)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+ runReplay sits between the parsers and the buckets : it turns the events into live ones, at the pace of their timestamps.
+ Once replayTomb is dying, events are forwarded without delay. It's over when the parsers are dead, as nothing can be sent anymore.
+*/
+func runReplay(input chan types.Event, output chan types.Event, speed float64) error {
+	pacer := leaky.NewPacer(speed)
+	for {
+		select {
+		case <-parsersTomb.Dead():
+			log.Infof("Exiting replay routine")
+			return nil
+		case parsed := <-input:
+			pacer.Wait(&parsed, replayTomb.Dying())
+			select {
+			case output <- parsed:
+			case <-bucketsTomb.Dying():
+				log.Infof("Exiting replay routine")
+				return nil
+			}
+		}
+	}
+}
@@ -101,7 +101,14 @@ func ShutdownRoutines() error {
 		log.Warningf("Acquisition returned error : %s", err)
 		reterr = err
 	}
+	if err := acquisition.AcquisSavePositions(acquisitionCTX); err != nil {
+		log.Warningf("Failed to save positions : %s", err)
+	}
 	log.Infof("acquisition is finished, wait for parser/bucket/ouputs.")
+	//stop pacing, so that the parsers can hand over their last events
+	if cConfig.Replay {
+		replayTomb.Kill(nil)
+	}
 	parsersTomb.Kill(nil)
 	if err := parsersTomb.Wait(); err != nil {
 		log.Warningf("Parsers returned error : %s", err)
@@ -114,6 +121,11 @@ func ShutdownRoutines() error {
 		reterr = err
 	}
 	log.Infof("buckets is done")
+	if cConfig.Replay {
+		if err := replayTomb.Wait(); err != nil {
+			log.Warningf("Replay returned error : %s", err)
+		}
+	}
 	outputsTomb.Kill(nil)
 	if err := outputsTomb.Wait(); err != nil {
 		log.Warningf("Ouputs returned error : %s", err)
@@ -129,16 +141,38 @@ func termHandler(sig os.Signal) error {
 	if err := ShutdownRoutines(); err != nil {
 		log.Errorf("Error encountered while shutting down routines : %s", err)
 	}
+	closeUnparsedSink()
 	log.Warningf("all routines are done, bye.")
 	return daemon.ErrStop
 }
 
+func closeUnparsedSink() {
+	if unparsedSink == nil {
+		return
+	}
+	if err := unparsedSink.Close(); err != nil {
+		log.Warningf("Failed to close unparsed lines sink : %s", err)
+	}
+}
+
 func serveOneTimeRun(outputRunner outputs.Output) error {
 	if err := acquisTomb.Wait(); err != nil {
 		log.Warningf("acquisition returned error : %s", err)
 	}
 	log.Infof("acquisition is finished, wait for parser/bucket/ouputs.")
 
+	//the replay is over once the parsers handed over their last events, and those were poured at their pace
+	if cConfig.Replay {
+		parsersTomb.Kill(nil)
+		if err := parsersTomb.Wait(); err != nil {
+			log.Warningf("parsers returned error : %s", err)
+		}
+		if err := replayTomb.Wait(); err != nil {
+			log.Warningf("replay returned error : %s", err)
+		}
+		log.Infof("replay is over")
+	}
+
 	/*
 		While it might make sense to want to shut-down parser/buckets/etc. as soon as acquisition is finished,
 		we might have some pending buckets : buckets that overflowed, but which LeakRoutine are still alive because they
@@ -180,6 +214,7 @@ func serveOneTimeRun(outputRunner outputs.Output) error {
 	if err := ShutdownRoutines(); err != nil {
 		log.Errorf("failed shutting down routines : %s", err)
 	}
+	closeUnparsedSink()
 	dumpMetrics()
 	outputRunner.Flush()
 	log.Warningf("all routines are done, bye.")
@@ -0,0 +1,251 @@
+package acquisition
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ DataSource is implemented by every acquisition backend (file, bin, ...).
+ Each backend registers itself with RegisterDataSource and is picked
+ according to the `type` of the acquis.yaml item.
+*/
+type DataSource interface {
+	//Configure is given the raw yaml of the acquis.yaml item, so that each source can have its own config struct
+	Configure([]byte) error
+	//Mode returns TAILMODE or CATMODE
+	Mode() string
+	//Name is a human-readable description of the source, used for logging
+	Name() string
+	//StartReading starts the reading routines in the tomb and pushes events to the chan.
+	//The routines must exit when the tomb is dying, and in CATMODE when everything has been read.
+	StartReading(chan types.Event, *tomb.Tomb) error
+}
+
+//DataSourceCommonCfg holds the settings every acquisition item has, whatever its type
+type DataSourceCommonCfg struct {
+	Type         string            `yaml:"type,omitempty"` //file|bin|...
+	Mode         string            `yaml:"mode,omitempty"` //tail|cat|...
+	Labels       map[string]string `yaml:"labels,omitempty"`
+	Profiling    bool              `yaml:"profiling,omitempty"`
+	BufferSize   int               `yaml:"buffer_size,omitempty"`   //events buffered between the source and the parsers, none by default
+	BufferPolicy string            `yaml:"buffer_policy,omitempty"` //block|drop_oldest|drop_newest, when the buffer is full
+}
+
+type AcquisCtx struct {
+	Sources   []DataSource
+	Profiling bool
+	Positions *PositionStore //nil unless positions_path is set
+}
+
+const (
+	TAILMODE = "tail"
+	CATMODE  = "cat"
+)
+
+var ReaderHits = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cs_reader_hits_total",
+		Help: "Total lines where read.",
+	},
+	[]string{"source"},
+)
+
+//dataSources holds the constructor of each registered acquisition type
+var dataSources = map[string]func() DataSource{}
+
+//RegisterDataSource makes a new acquisition type available to acquis.yaml. It is meant to be called from init()
+func RegisterDataSource(name string, newSource func() DataSource) {
+	if _, ok := dataSources[name]; ok {
+		log.Fatalf("acquisition type '%s' is already registered", name)
+	}
+	dataSources[name] = newSource
+}
+
+//GetDataSourceTypes returns the sorted list of registered acquisition types
+func GetDataSourceTypes() []string {
+	ret := []string{}
+	for name := range dataSources {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+//DataSourceFromConfig instantiates and configures the source described by the yaml of one acquisition item
+func DataSourceFromConfig(rawCfg []byte) (DataSource, error) {
+	common := DataSourceCommonCfg{}
+	//only the common part is decoded here, the strict decoding is the job of the source itself
+	if err := yaml.Unmarshal(rawCfg, &common); err != nil {
+		return nil, fmt.Errorf("while parsing acquisition item : %s", err)
+	}
+	//defaults to file type
+	if common.Type == "" {
+		common.Type = FILETYPE
+	}
+	newSource, ok := dataSources[common.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown acquisition type '%s' (available : %v)", common.Type, GetDataSourceTypes())
+	}
+	source := newSource()
+	if err := source.Configure(rawCfg); err != nil {
+		return nil, fmt.Errorf("while configuring %s acquisition : %s", common.Type, err)
+	}
+	if err := checkBufferConfig(common); err != nil {
+		return nil, fmt.Errorf("while configuring %s acquisition : %s", common.Type, err)
+	}
+	if common.BufferSize > 0 {
+		return newBufferedSource(source, common), nil
+	}
+	return source, nil
+}
+
+func LoadAcquisitionConfig(cConfig *csconfig.CrowdSec) (*AcquisCtx, error) {
+	var acquisitionCTX *AcquisCtx
+	var err error
+	/*Init the acqusition : from cli or from acquis.yaml file*/
+	if cConfig.SingleFile == STDIN {
+		input := PipeConfiguration{}
+		input.Filename = STDIN
+		input.Type = PIPETYPE
+		input.Mode = CATMODE
+		input.Labels = make(map[string]string)
+		input.Labels["type"] = cConfig.SingleFileLabel
+		acquisitionCTX, err = InitReaderFromConfig([]interface{}{input})
+	} else if cConfig.SingleFile != "" {
+		input := FileConfiguration{}
+		input.Filename = cConfig.SingleFile
+		input.Type = FILETYPE
+		input.Mode = CATMODE
+		input.Labels = make(map[string]string)
+		input.Labels["type"] = cConfig.SingleFileLabel
+		acquisitionCTX, err = InitReaderFromConfig([]interface{}{input})
+	} else { /* Init file reader if we tail */
+		acquisitionCTX, err = InitReader(cConfig.AcquisitionFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to start file acquisition, bailout %v", err)
+	}
+	if acquisitionCTX == nil {
+		return nil, fmt.Errorf("no inputs to process")
+	}
+	if cConfig.Profiling {
+		acquisitionCTX.Profiling = true
+	}
+	//positions only make sense when tailing
+	if cConfig.PositionsPath != "" && cConfig.SingleFile == "" {
+		acquisitionCTX.Positions, err = NewPositionStore(cConfig.PositionsPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range acquisitionCTX.Sources {
+			if fileSource, ok := unwrapSource(source).(*FileSource); ok {
+				fileSource.positions = acquisitionCTX.Positions
+				//the positions only move forward once the events left the buffer
+				if buffered, ok := source.(*bufferedSource); ok {
+					fileSource.pending = newPositionQueue(acquisitionCTX.Positions)
+					buffered.tracker = fileSource.pending
+				}
+			}
+		}
+	}
+
+	return acquisitionCTX, nil
+}
+
+func InitReader(cfg string) (*AcquisCtx, error) {
+	var items []interface{}
+
+	yamlFile, err := os.Open(cfg)
+	if err != nil {
+		log.Errorf("Can't access acquisition configuration file with '%v'.", err)
+		return nil, err
+	}
+	defer yamlFile.Close()
+	//process the yaml
+	dec := yaml.NewDecoder(yamlFile)
+	for {
+		t := map[string]interface{}{}
+		err = dec.Decode(&t)
+		if err != nil {
+			if err == io.EOF {
+				log.Tracef("End of yaml file")
+				break
+			}
+			return nil, fmt.Errorf("error decoding acquisition configuration file with '%s': %v", cfg, err)
+		}
+		//trailing '---' leads to empty items
+		if len(t) == 0 {
+			continue
+		}
+		items = append(items, t)
+	}
+	return InitReaderFromConfig(items)
+}
+
+//InitReaderFromConfig instantiates one DataSource for each acquisition item (either raw yaml or config structs)
+func InitReaderFromConfig(items []interface{}) (*AcquisCtx, error) {
+
+	var ctx *AcquisCtx = &AcquisCtx{}
+
+	for _, item := range items {
+		rawCfg, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("while serializing acquisition item : %s", err)
+		}
+		common := DataSourceCommonCfg{}
+		if err := yaml.Unmarshal(rawCfg, &common); err != nil {
+			return nil, fmt.Errorf("while parsing acquisition item : %s", err)
+		}
+		//minimalist sanity check
+		if len(common.Labels) == 0 {
+			log.Infof("Acquisition has no tags, skipping empty item %+v", item)
+			continue
+		}
+		source, err := DataSourceFromConfig(rawCfg)
+		if err != nil {
+			return nil, err
+		}
+		ctx.Sources = append(ctx.Sources, source)
+	}
+	return ctx, nil
+}
+
+//let's return an array of chans for signaling for now
+func AcquisStartReading(ctx *AcquisCtx, output chan types.Event, AcquisTomb *tomb.Tomb) {
+
+	if len(ctx.Sources) == 0 {
+		log.Errorf("No sources to read")
+	}
+	/* each source starts its own go routines, pushing to chan output */
+	for idx, source := range ctx.Sources {
+		log.Printf("starting (%s) reader %d/%d : %s", source.Mode(), idx+1, len(ctx.Sources), source.Name())
+		if err := source.StartReading(output, AcquisTomb); err != nil {
+			log.Errorf("failed to start %s : %s", source.Name(), err)
+		}
+	}
+	if ctx.Positions != nil {
+		AcquisTomb.Go(func() error {
+			return ctx.Positions.SaveRoutine(AcquisTomb)
+		})
+	}
+	log.Printf("Started %d acquisition sources", len(ctx.Sources))
+}
+
+//AcquisSavePositions flushes the positions of the tailed files, it is meant to be called once acquisition is stopped
+func AcquisSavePositions(ctx *AcquisCtx) error {
+	if ctx == nil || ctx.Positions == nil {
+		return nil
+	}
+	return ctx.Positions.Save()
+}
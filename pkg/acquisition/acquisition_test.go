@@ -0,0 +1,111 @@
+package acquisition
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+type mockSourceCfg struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	Toto                string `yaml:"toto"`
+}
+
+type mockSource struct {
+	config mockSourceCfg
+}
+
+func (m *mockSource) Configure(cfg []byte) error {
+	if err := yaml.UnmarshalStrict(cfg, &m.config); err != nil {
+		return err
+	}
+	if m.config.Toto == "" {
+		return fmt.Errorf("missing toto")
+	}
+	return nil
+}
+
+func (m *mockSource) Mode() string { return CATMODE }
+
+func (m *mockSource) Name() string { return "mock:" + m.config.Toto }
+
+func (m *mockSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	AcquisTomb.Go(func() error {
+		output <- types.Event{Line: types.Line{Raw: m.config.Toto, Labels: m.config.Labels}, Process: true}
+		return nil
+	})
+	return nil
+}
+
+func TestDataSourceFromConfig(t *testing.T) {
+	RegisterDataSource("mock", func() DataSource { return &mockSource{} })
+	defer delete(dataSources, "mock")
+
+	tests := []struct {
+		config string
+		name   string
+		err    string
+	}{
+		{
+			config: "type: mock\ntoto: foobar\nlabels:\n  type: test\n",
+			name:   "mock:foobar",
+		},
+		{
+			config: "type: mock\nlabels:\n  type: test\n",
+			err:    "while configuring mock acquisition : missing toto",
+		},
+		{
+			config: "type: mock\ntoto: foobar\nfilename: /tmp/x\nlabels:\n  type: test\n",
+			err:    "while configuring mock acquisition : yaml: unmarshal errors:\n  line 3: field filename not found in type acquisition.mockSourceCfg",
+		},
+		{
+			config: "type: ratata\nlabels:\n  type: test\n",
+			err:    "unknown acquisition type 'ratata' (available : [bin docker file http journald mock pipe syslog])",
+		},
+		{
+			config: "filename: ./tests/test.log\nlabels:\n  type: test\n",
+			name:   "file:./tests/test.log",
+		},
+	}
+
+	for _, test := range tests {
+		source, err := DataSourceFromConfig([]byte(test.config))
+		if test.err != "" {
+			assert.EqualError(t, err, test.err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error : %s", err)
+		}
+		assert.Equal(t, test.name, source.Name())
+	}
+}
+
+func TestAcquisStartReadingCustomSource(t *testing.T) {
+	RegisterDataSource("mock", func() DataSource { return &mockSource{} })
+	defer delete(dataSources, "mock")
+
+	ctx, err := InitReaderFromConfig([]interface{}{
+		map[string]interface{}{"type": "mock", "toto": "hello", "labels": map[string]string{"type": "test"}},
+		//no labels, skipped
+		map[string]interface{}{"type": "mock", "toto": "world"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	assert.Equal(t, 1, len(ctx.Sources))
+
+	output := make(chan types.Event, 1)
+	acquisTomb := tomb.Tomb{}
+	AcquisStartReading(ctx, output, &acquisTomb)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	evt := <-output
+	assert.Equal(t, "hello", evt.Line.Raw)
+	assert.Equal(t, "test", evt.Line.Labels["type"])
+}
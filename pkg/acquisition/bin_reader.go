@@ -0,0 +1,95 @@
+package acquisition
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const BINTYPE = "bin"
+
+/*BinSource reads serialized events (only overflows for now) from a json file, at once*/
+type BinSource struct {
+	config FileConfiguration
+}
+
+func init() {
+	RegisterDataSource(BINTYPE, func() DataSource { return &BinSource{} })
+}
+
+func (b *BinSource) Configure(cfg []byte) error {
+	binConfig := FileConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &binConfig); err != nil {
+		return fmt.Errorf("while parsing bin acquisition : %s", err)
+	}
+	if binConfig.Mode == "" {
+		binConfig.Mode = CATMODE
+	}
+	if binConfig.Mode != CATMODE {
+		return fmt.Errorf("bin acquisition only supports %s mode", CATMODE)
+	}
+	if binConfig.Filename == "" {
+		return fmt.Errorf("bin acquisition requires a filename")
+	}
+	b.config = binConfig
+	return nil
+}
+
+func (b *BinSource) Mode() string {
+	return b.config.Mode
+}
+
+func (b *BinSource) Name() string {
+	return fmt.Sprintf("bin:%s", b.config.Filename)
+}
+
+func (b *BinSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	AcquisTomb.Go(func() error {
+		return b.readEvents(output, AcquisTomb)
+	})
+	return nil
+}
+
+func (b *BinSource) readEvents(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	clog := log.WithFields(log.Fields{
+		"file": b.config.Filename,
+	})
+	fd, err := os.Open(b.config.Filename)
+	if err != nil {
+		clog.Errorf("Failed opening file: %s", err)
+		return err
+	}
+	defer fd.Close()
+
+	dec := json.NewDecoder(fd)
+	count := 0
+	for {
+		var p types.Event
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Warningf("While reading %s : %s", fd.Name(), err)
+			continue
+		}
+		count++
+		p.Type = types.OVFLW
+		p.Process = true
+		//we're reading logs at once, it must be time-machine buckets
+		p.ExpectMode = leaky.TIMEMACHINE
+		select {
+		case output <- p:
+		case <-AcquisTomb.Dying():
+			return nil
+		}
+	}
+	clog.Warningf("unmarshaled %d events", count)
+	return nil
+}
@@ -0,0 +1,210 @@
+package acquisition
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+)
+
+//what to do with a new event when the buffer of a source is full
+const (
+	BLOCKPOLICY      = "block"       //wait for the parsers, the source falls behind
+	DROPOLDESTPOLICY = "drop_oldest" //make room by dropping the oldest buffered event
+	DROPNEWESTPOLICY = "drop_newest" //drop the new event
+)
+
+//BufferDrainTimeout is how long the buffered events can take to reach the parsers when acquisition is stopped
+var BufferDrainTimeout = 10 * time.Second
+
+var ReaderQueueDepth = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "cs_reader_queue_depth",
+		Help: "Number of events waiting in the buffer of a source.",
+	},
+	[]string{"source"},
+)
+
+var ReaderDropped = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cs_reader_dropped_total",
+		Help: "Total events dropped because the buffer of a source was full.",
+	},
+	[]string{"source"},
+)
+
+var ReaderLag = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "cs_reader_lag_seconds",
+		Help: "Time the last event spent in the buffer of a source.",
+	},
+	[]string{"source"},
+)
+
+func checkBufferConfig(common DataSourceCommonCfg) error {
+	if common.BufferSize < 0 {
+		return fmt.Errorf("buffer_size can't be negative")
+	}
+	switch common.BufferPolicy {
+	case "", BLOCKPOLICY, DROPOLDESTPOLICY, DROPNEWESTPOLICY:
+	default:
+		return fmt.Errorf("unknown buffer_policy '%s' (expected %s, %s or %s)", common.BufferPolicy, BLOCKPOLICY, DROPOLDESTPOLICY, DROPNEWESTPOLICY)
+	}
+	if common.BufferPolicy != "" && common.BufferSize == 0 {
+		return fmt.Errorf("buffer_policy requires buffer_size")
+	}
+	return nil
+}
+
+/*
+ bufferedSource puts a bounded queue between a source and the parsers, so that a slow parser doesn't stall the source.
+ The source runs in its own tomb : the pump forwards what is left in the queue once it's done.
+*/
+type bufferedSource struct {
+	DataSource
+	size    int
+	policy  string
+	tracker bufferTracker //optional
+}
+
+//bufferTracker is told when the events leave the buffer, so that the source knows which ones were actually handled
+type bufferTracker interface {
+	Released(evt types.Event)  //the oldest event left the buffer, forwarded or dropped
+	Discarded(evt types.Event) //the newest event was dropped on arrival
+}
+
+type bufferedEvent struct {
+	evt      types.Event
+	received time.Time
+}
+
+func newBufferedSource(source DataSource, common DataSourceCommonCfg) *bufferedSource {
+	policy := common.BufferPolicy
+	if policy == "" {
+		policy = BLOCKPOLICY
+	}
+	return &bufferedSource{DataSource: source, size: common.BufferSize, policy: policy}
+}
+
+//unwrapSource returns the actual source behind the buffer, if any
+func unwrapSource(source DataSource) DataSource {
+	if buffered, ok := source.(*bufferedSource); ok {
+		return buffered.DataSource
+	}
+	return source
+}
+
+func (b *bufferedSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	sourceTomb := &tomb.Tomb{}
+	input := make(chan types.Event)
+
+	//keeps the tomb alive while the source starts, so that it dies by itself once the source routines are done
+	started := make(chan struct{})
+	sourceTomb.Go(func() error {
+		<-started
+		return nil
+	})
+	err := b.DataSource.StartReading(input, sourceTomb)
+	close(started)
+	if err != nil {
+		sourceTomb.Kill(nil)
+		return err
+	}
+	AcquisTomb.Go(func() error {
+		select {
+		case <-AcquisTomb.Dying():
+			sourceTomb.Kill(nil)
+		case <-sourceTomb.Dead():
+		}
+		return nil
+	})
+	AcquisTomb.Go(func() error {
+		return b.pump(input, output, sourceTomb, AcquisTomb)
+	})
+	return nil
+}
+
+func (b *bufferedSource) pump(input chan types.Event, output chan types.Event, sourceTomb *tomb.Tomb, AcquisTomb *tomb.Tomb) error {
+	var queue []bufferedEvent
+
+	labels := prometheus.Labels{"source": b.Name()}
+	depth := ReaderQueueDepth.With(labels)
+	dropped := ReaderDropped.With(labels)
+	lag := ReaderLag.With(labels)
+	sourceDead := sourceTomb.Dead()
+	defer depth.Set(0)
+	for {
+		var out chan types.Event
+		var next types.Event
+		in := input
+		if len(queue) > 0 {
+			out = output
+			next = queue[0].evt
+		}
+		if b.policy == BLOCKPOLICY && len(queue) >= b.size {
+			in = nil
+		}
+		select {
+		case evt := <-in:
+			if len(queue) >= b.size {
+				dropped.Inc()
+				if b.policy == DROPNEWESTPOLICY {
+					b.discarded(evt)
+					continue
+				}
+				b.released(queue[0].evt)
+				queue = queue[1:]
+			}
+			queue = append(queue, bufferedEvent{evt: evt, received: time.Now()})
+		case out <- next:
+			lag.Set(time.Since(queue[0].received).Seconds())
+			b.released(queue[0].evt)
+			queue = queue[1:]
+		case <-sourceDead:
+			//nothing will be received anymore, forward what's left
+			sourceDead = nil
+		case <-AcquisTomb.Dying():
+			return b.drain(queue, output, sourceTomb)
+		}
+		depth.Set(float64(len(queue)))
+		if sourceDead == nil && len(queue) == 0 {
+			return sourceTomb.Err()
+		}
+	}
+}
+
+/*
+ drain forwards the buffered events when acquisition is stopped, as the parsers are still running.
+ The positions of the tailed files don't account for the events that can't be forwarded in time : they are read again on restart.
+*/
+func (b *bufferedSource) drain(queue []bufferedEvent, output chan types.Event, sourceTomb *tomb.Tomb) error {
+	<-sourceTomb.Dead()
+	timeout := time.NewTimer(BufferDrainTimeout)
+	defer timeout.Stop()
+	for idx, buffered := range queue {
+		select {
+		case output <- buffered.evt:
+			b.released(buffered.evt)
+		case <-timeout.C:
+			log.Warningf("%s : %d buffered events not processed on shutdown", b.Name(), len(queue)-idx)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (b *bufferedSource) released(evt types.Event) {
+	if b.tracker != nil {
+		b.tracker.Released(evt)
+	}
+}
+
+func (b *bufferedSource) discarded(evt types.Event) {
+	if b.tracker != nil {
+		b.tracker.Discarded(evt)
+	}
+}
@@ -0,0 +1,155 @@
+package acquisition
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+type burstSourceCfg struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	Count               int `yaml:"count"`
+}
+
+//burstSource sends count events at once, and in tail mode waits to be killed
+type burstSource struct {
+	config burstSourceCfg
+}
+
+func (b *burstSource) Configure(cfg []byte) error {
+	return yaml.UnmarshalStrict(cfg, &b.config)
+}
+
+func (b *burstSource) Mode() string { return b.config.Mode }
+
+func (b *burstSource) Name() string { return "burst:" + b.config.Labels["type"] }
+
+func (b *burstSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	AcquisTomb.Go(func() error {
+		for i := 0; i < b.config.Count; i++ {
+			select {
+			case output <- types.Event{Line: types.Line{Raw: strconv.Itoa(i)}, Process: true}:
+			case <-AcquisTomb.Dying():
+				return nil
+			}
+		}
+		if b.config.Mode == TAILMODE {
+			<-AcquisTomb.Dying()
+		}
+		return nil
+	})
+	return nil
+}
+
+func readRaws(output chan types.Event, count int) []string {
+	raws := []string{}
+	for _, evt := range readEvents(output, count) {
+		raws = append(raws, evt.Line.Raw)
+	}
+	return raws
+}
+
+func TestBufferedSource(t *testing.T) {
+	RegisterDataSource("burst", func() DataSource { return &burstSource{} })
+	defer delete(dataSources, "burst")
+
+	tests := []struct {
+		config  string
+		raws    []string
+		dropped float64
+	}{
+		{
+			config: "type: burst\nmode: cat\ncount: 5\nbuffer_size: 2\nlabels:\n  type: block\n",
+			raws:   []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			config:  "type: burst\nmode: cat\ncount: 5\nbuffer_size: 2\nbuffer_policy: drop_oldest\nlabels:\n  type: drop_oldest\n",
+			raws:    []string{"3", "4"},
+			dropped: 3,
+		},
+		{
+			config:  "type: burst\nmode: cat\ncount: 5\nbuffer_size: 2\nbuffer_policy: drop_newest\nlabels:\n  type: drop_newest\n",
+			raws:    []string{"0", "1"},
+			dropped: 3,
+		},
+	}
+	for _, test := range tests {
+		source, err := DataSourceFromConfig([]byte(test.config))
+		if err != nil {
+			t.Fatalf("unexpected error : %s", err)
+		}
+		output := make(chan types.Event)
+		acquisTomb := tomb.Tomb{}
+		if err := source.StartReading(output, &acquisTomb); err != nil {
+			t.Fatalf("unexpected error : %s", err)
+		}
+		//the parsers are slow
+		time.Sleep(200 * time.Millisecond)
+		labels := prometheus.Labels{"source": source.Name()}
+		if test.dropped == 0 {
+			assert.Equal(t, float64(2), testutil.ToFloat64(ReaderQueueDepth.With(labels)))
+		}
+		assert.Equal(t, test.raws, readRaws(output, 6), test.config)
+		assert.Equal(t, test.dropped, testutil.ToFloat64(ReaderDropped.With(labels)))
+		//the source is done and the buffer is empty
+		if err := acquisTomb.Wait(); err != nil {
+			t.Fatalf("acquisition returned error : %s", err)
+		}
+		assert.Equal(t, float64(0), testutil.ToFloat64(ReaderQueueDepth.With(labels)))
+	}
+}
+
+func TestBufferedSourceShutdown(t *testing.T) {
+	RegisterDataSource("burst", func() DataSource { return &burstSource{} })
+	defer delete(dataSources, "burst")
+
+	source, err := DataSourceFromConfig([]byte("type: burst\nmode: tail\ncount: 3\nbuffer_size: 10\nlabels:\n  type: shutdown\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	//the buffered events are still handed to the parsers
+	acquisTomb.Kill(nil)
+	assert.Equal(t, []string{"0", "1", "2"}, readRaws(output, 4))
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestBufferConfig(t *testing.T) {
+	RegisterDataSource("burst", func() DataSource { return &burstSource{} })
+	defer delete(dataSources, "burst")
+
+	_, err := DataSourceFromConfig([]byte("type: burst\nbuffer_size: 10\nbuffer_policy: drop\nlabels:\n  type: test\n"))
+	assert.EqualError(t, err, "while configuring burst acquisition : unknown buffer_policy 'drop' (expected block, drop_oldest or drop_newest)")
+	_, err = DataSourceFromConfig([]byte("type: burst\nbuffer_policy: drop_oldest\nlabels:\n  type: test\n"))
+	assert.EqualError(t, err, "while configuring burst acquisition : buffer_policy requires buffer_size")
+	_, err = DataSourceFromConfig([]byte("type: burst\nbuffer_size: -1\nlabels:\n  type: test\n"))
+	assert.EqualError(t, err, "while configuring burst acquisition : buffer_size can't be negative")
+
+	//without buffer, the source is used as-is
+	source, err := DataSourceFromConfig([]byte("type: burst\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	_, ok := source.(*burstSource)
+	assert.True(t, ok)
+	source, err = DataSourceFromConfig([]byte("type: burst\nbuffer_size: 10\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	_, ok = unwrapSource(source).(*burstSource)
+	assert.True(t, ok)
+}
@@ -0,0 +1,141 @@
+package acquisition
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*the log formats of the container runtimes, as found in /var/log/containers/*.log*/
+const (
+	CRIFORMAT    = "cri"    //2020-05-01T10:00:00.123Z stdout F <message>
+	DOCKERFORMAT = "docker" //{"log":"<message>\n","stream":"stdout","time":"2020-05-01T10:00:00.123Z"}
+	AUTOFORMAT   = "auto"   //guessed for each line
+)
+
+//maxPartialSize bounds the size of a line reassembled from partial ones
+var maxPartialSize = 1024 * 1024
+
+func checkContainerFormat(format string) error {
+	switch format {
+	case "", CRIFORMAT, DOCKERFORMAT, AUTOFORMAT:
+		return nil
+	}
+	return fmt.Errorf("unknown container_format '%s' (expected %s, %s or %s)", format, CRIFORMAT, DOCKERFORMAT, AUTOFORMAT)
+}
+
+/*ContainerDecoder unwraps the lines written by the container runtimes, there is one per file as it holds the pending partial line*/
+type ContainerDecoder struct {
+	format  string
+	partial strings.Builder
+	time    time.Time //the time of the first part of the pending line
+}
+
+func NewContainerDecoder(format string) *ContainerDecoder {
+	return &ContainerDecoder{format: format}
+}
+
+type dockerJSONLine struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+/*
+ Decode returns the message and the runtime timestamp of a line, ok is false if the line is only a part of the message.
+ Lines not matching the format are returned as they are, along with the default time.
+*/
+func (c *ContainerDecoder) Decode(line string, defaultTime time.Time) (string, time.Time, bool) {
+	var message string
+	var ts time.Time
+	var partial bool
+	var err error
+
+	format := c.format
+	if format == AUTOFORMAT {
+		format = CRIFORMAT
+		if strings.HasPrefix(line, "{") {
+			format = DOCKERFORMAT
+		}
+	}
+	if format == DOCKERFORMAT {
+		message, ts, partial, err = decodeDockerLine(line)
+	} else {
+		message, ts, partial, err = decodeCRILine(line)
+	}
+	if err != nil {
+		return line, defaultTime, true
+	}
+	if !c.Pending() {
+		c.time = ts
+	}
+	if !partial && !c.Pending() {
+		return message, ts, true
+	}
+	c.partial.WriteString(message)
+	if partial && c.partial.Len() < maxPartialSize {
+		return "", time.Time{}, false
+	}
+	message, ts = c.flush()
+	return message, ts, true
+}
+
+//Pending is true when a partial line is waiting for its end
+func (c *ContainerDecoder) Pending() bool {
+	return c.partial.Len() > 0
+}
+
+//Flush returns the pending partial line, if any
+func (c *ContainerDecoder) Flush() (string, time.Time, bool) {
+	if !c.Pending() {
+		return "", time.Time{}, false
+	}
+	message, ts := c.flush()
+	return message, ts, true
+}
+
+func (c *ContainerDecoder) flush() (string, time.Time) {
+	message := c.partial.String()
+	c.partial.Reset()
+	return message, c.time
+}
+
+/*decodeCRILine parses `<RFC3339Nano time> <stream> <tag> <message>`, the tag being F (full) or P (partial) followed by optional :-separated tags*/
+func decodeCRILine(line string) (string, time.Time, bool, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return "", time.Time{}, false, fmt.Errorf("not a cri line")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return "", time.Time{}, false, fmt.Errorf("invalid cri time : %s", err)
+	}
+	if fields[1] != "stdout" && fields[1] != "stderr" {
+		return "", time.Time{}, false, fmt.Errorf("invalid cri stream '%s'", fields[1])
+	}
+	tag := strings.SplitN(fields[2], ":", 2)[0]
+	if tag != "F" && tag != "P" {
+		return "", time.Time{}, false, fmt.Errorf("invalid cri tag '%s'", fields[2])
+	}
+	message := ""
+	if len(fields) == 4 {
+		message = fields[3]
+	}
+	return message, ts, tag == "P", nil
+}
+
+/*decodeDockerLine parses the json-file logging driver lines, the message being partial when it doesn't end with a newline*/
+func decodeDockerLine(line string) (string, time.Time, bool, error) {
+	dockerLine := dockerJSONLine{}
+	if err := json.Unmarshal([]byte(line), &dockerLine); err != nil {
+		return "", time.Time{}, false, fmt.Errorf("invalid docker json line : %s", err)
+	}
+	if dockerLine.Time.IsZero() {
+		return "", time.Time{}, false, fmt.Errorf("docker json line without time")
+	}
+	if strings.HasSuffix(dockerLine.Log, "\n") {
+		return strings.TrimRight(dockerLine.Log, "\r\n"), dockerLine.Time, false, nil
+	}
+	return dockerLine.Log, dockerLine.Time, true, nil
+}
@@ -0,0 +1,178 @@
+package acquisition
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func TestContainerDecoder(t *testing.T) {
+	now := time.Now()
+	ts, _ := time.Parse(time.RFC3339Nano, "2020-05-01T10:00:00.123Z")
+	tests := []struct {
+		format  string
+		lines   []string
+		message string
+		time    time.Time
+	}{
+		{
+			format:  CRIFORMAT,
+			lines:   []string{"2020-05-01T10:00:00.123Z stdout F hello world"},
+			message: "hello world",
+			time:    ts,
+		},
+		{
+			format:  CRIFORMAT,
+			lines:   []string{"2020-05-01T10:00:00.123Z stdout P hello ", "2020-05-01T10:00:01Z stdout P big ", "2020-05-01T10:00:02Z stdout F world"},
+			message: "hello big world",
+			time:    ts,
+		},
+		{
+			format:  DOCKERFORMAT,
+			lines:   []string{`{"log":"hello world\n","stream":"stdout","time":"2020-05-01T10:00:00.123Z"}`},
+			message: "hello world",
+			time:    ts,
+		},
+		{
+			format:  DOCKERFORMAT,
+			lines:   []string{`{"log":"hello ","stream":"stdout","time":"2020-05-01T10:00:00.123Z"}`, `{"log":"world\r\n","stream":"stdout","time":"2020-05-01T10:00:01Z"}`},
+			message: "hello world",
+			time:    ts,
+		},
+		{
+			format:  AUTOFORMAT,
+			lines:   []string{`{"log":"hello world\n","stream":"stderr","time":"2020-05-01T10:00:00.123Z"}`},
+			message: "hello world",
+			time:    ts,
+		},
+		{
+			format:  AUTOFORMAT,
+			lines:   []string{"2020-05-01T10:00:00.123Z stderr F:x hello world"},
+			message: "hello world",
+			time:    ts,
+		},
+		//lines not matching the format are kept as they are
+		{
+			format:  CRIFORMAT,
+			lines:   []string{"May  1 10:00:00 myhost sshd[42]: hello world"},
+			message: "May  1 10:00:00 myhost sshd[42]: hello world",
+			time:    now,
+		},
+		{
+			format:  DOCKERFORMAT,
+			lines:   []string{`{"log":"hello world\n"}`},
+			message: `{"log":"hello world\n"}`,
+			time:    now,
+		},
+	}
+	for _, test := range tests {
+		decoder := NewContainerDecoder(test.format)
+		for idx, line := range test.lines {
+			message, msgTime, ok := decoder.Decode(line, now)
+			if idx < len(test.lines)-1 {
+				assert.False(t, ok, "%s should be partial", line)
+				continue
+			}
+			assert.True(t, ok)
+			assert.Equal(t, test.message, message)
+			assert.True(t, test.time.Equal(msgTime), "%s : expected %s, got %s", line, test.time, msgTime)
+		}
+		assert.False(t, decoder.Pending())
+	}
+}
+
+func TestContainerDecoderMaxSize(t *testing.T) {
+	maxPartialSize = 10
+	defer func() { maxPartialSize = 1024 * 1024 }()
+	decoder := NewContainerDecoder(CRIFORMAT)
+	_, _, ok := decoder.Decode("2020-05-01T10:00:00Z stdout P 12345", time.Now())
+	assert.False(t, ok)
+	message, _, ok := decoder.Decode("2020-05-01T10:00:01Z stdout P 67890", time.Now())
+	assert.True(t, ok)
+	assert.Equal(t, "1234567890", message)
+	assert.False(t, decoder.Pending())
+}
+
+func TestCatContainerFormat(t *testing.T) {
+	_, err := DataSourceFromConfig([]byte("filename: ./tests/cri.log\ncontainer_format: crio\nlabels:\n  type: nginx\n"))
+	assert.EqualError(t, err, "while configuring file acquisition : unknown container_format 'crio' (expected cri, docker or auto)")
+
+	source, err := DataSourceFromConfig([]byte("filename: ./tests/cri.log\nmode: cat\ncontainer_format: cri\nlabels:\n  type: nginx\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	evts := readEvents(output, 5)
+	//the empty line is skipped
+	if len(evts) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(evts))
+	}
+	assert.Equal(t, `1.2.3.4 - - [01/May/2020:10:00:00 +0000] "GET / HTTP/1.1" 200 612`, evts[0].Line.Raw)
+	assert.Equal(t, "2020-05-01T10:00:00.123456789Z", evts[0].StrTime)
+	assert.Equal(t, "2020-05-01T10:00:00.123456789Z", evts[0].Line.Time.Format(time.RFC3339Nano))
+	//the partial lines are reassembled, with the time of the first part
+	assert.Equal(t, "first part, second part, end", evts[1].Line.Raw)
+	assert.Equal(t, "2020-05-01T10:00:01Z", evts[1].StrTime)
+	assert.Equal(t, "not a cri line", evts[2].Line.Raw)
+	//the pending partial line is flushed at the end of the file
+	assert.Equal(t, "never ended", evts[3].Line.Raw)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestTailContainerFormatPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	full := "2020-05-01T10:00:00Z stdout F full line\n"
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte(full+"2020-05-01T10:00:01Z stdout P partial \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inode, _, err := fileInode(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPositionStore(filepath.Join(dir, "positions.json"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	store.Set(logFile, FilePosition{Inode: inode, Offset: 0})
+
+	source, err := DataSourceFromConfig([]byte("filename: " + logFile + "\ncontainer_format: auto\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	source.(*FileSource).positions = store
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	evts := readEvents(output, 2)
+	assert.Equal(t, 1, len(evts))
+	if len(evts) == 1 {
+		assert.Equal(t, "full line", evts[0].Line.Raw)
+	}
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	//the partial line will be read again on restart
+	pos, _ := store.Get(logFile)
+	assert.Equal(t, int64(len(full)), pos.Offset)
+}
@@ -0,0 +1,370 @@
+package acquisition
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const DOCKERTYPE = "docker"
+
+//a container that isn't running for that long is forgotten : if it ever restarts, its logs are read from its start
+var dockerForgetAfter = 24 * time.Hour
+
+type DockerConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	ContainerName       []string          `yaml:"container_name,omitempty"`
+	ContainerNameRegexp []string          `yaml:"container_name_regexp,omitempty"`
+	ContainerLabels     map[string]string `yaml:"container_labels,omitempty"`
+	DockerHost          string            `yaml:"docker_host,omitempty"`    //defaults to $DOCKER_HOST, or the local socket
+	CheckInterval       time.Duration     `yaml:"check_interval,omitempty"` //how often the running containers are listed
+}
+
+/*
+ DockerSource reads the stdout/stderr of the containers selected by name, name regexp or labels.
+ In tail mode, the running containers are listed every check_interval, so that the containers starting
+ (or stopping) at runtime are picked up.
+*/
+type DockerSource struct {
+	config     DockerConfiguration
+	nameRegexp []*regexp.Regexp
+	client     *client.Client
+	followed   map[string]*dockerContainer //the containers whose logs are being read, by id
+	lastSeen   map[string]time.Time        //the time of the last line of the containers we read, to resume on restart
+	lastListed map[string]time.Time        //the last time the containers of lastSeen were running, to forget the removed ones
+	lock       sync.Mutex
+}
+
+type dockerContainer struct {
+	id     string
+	name   string
+	labels map[string]string
+	cancel context.CancelFunc
+}
+
+func init() {
+	RegisterDataSource(DOCKERTYPE, func() DataSource { return &DockerSource{} })
+}
+
+func (d *DockerSource) Configure(cfg []byte) error {
+	dockerConfig := DockerConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &dockerConfig); err != nil {
+		return fmt.Errorf("while parsing docker acquisition : %s", err)
+	}
+	if dockerConfig.Mode == "" {
+		dockerConfig.Mode = TAILMODE
+	}
+	if dockerConfig.Mode != TAILMODE && dockerConfig.Mode != CATMODE {
+		return fmt.Errorf("unknown read mode %s for docker", dockerConfig.Mode)
+	}
+	if len(dockerConfig.ContainerName) == 0 && len(dockerConfig.ContainerNameRegexp) == 0 && len(dockerConfig.ContainerLabels) == 0 {
+		return fmt.Errorf("no container_name, container_name_regexp or container_labels")
+	}
+	d.nameRegexp = []*regexp.Regexp{}
+	for _, expr := range dockerConfig.ContainerNameRegexp {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid container_name_regexp '%s' : %s", expr, err)
+		}
+		d.nameRegexp = append(d.nameRegexp, re)
+	}
+	if dockerConfig.CheckInterval == 0 {
+		dockerConfig.CheckInterval = time.Second
+	}
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if dockerConfig.DockerHost != "" {
+		opts = append(opts, client.WithHost(dockerConfig.DockerHost))
+	}
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client : %s", err)
+	}
+	d.client = cli
+	d.config = dockerConfig
+	return nil
+}
+
+func (d *DockerSource) Mode() string {
+	return d.config.Mode
+}
+
+func (d *DockerSource) Name() string {
+	selectors := append([]string{}, d.config.ContainerName...)
+	selectors = append(selectors, d.config.ContainerNameRegexp...)
+	//the name labels the metrics, it mustn't depend on the order of the map
+	labels := make([]string, 0, len(d.config.ContainerLabels))
+	for k := range d.config.ContainerLabels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		selectors = append(selectors, k+"="+d.config.ContainerLabels[k])
+	}
+	return "docker:" + strings.Join(selectors, ",")
+}
+
+//matchContainer returns the name of the container if it's selected by any of the name, name regexp or labels
+func (d *DockerSource) matchContainer(container dockerTypes.Container) (string, bool) {
+	if len(container.Names) == 0 {
+		return "", false
+	}
+	//the names are prefixed by /
+	name := strings.TrimPrefix(container.Names[0], "/")
+	for _, expected := range d.config.ContainerName {
+		if name == expected {
+			return name, true
+		}
+	}
+	for _, re := range d.nameRegexp {
+		if re.MatchString(name) {
+			return name, true
+		}
+	}
+	if len(d.config.ContainerLabels) > 0 {
+		for k, v := range d.config.ContainerLabels {
+			if container.Labels[k] != v {
+				return name, false
+			}
+		}
+		return name, true
+	}
+	return name, false
+}
+
+func (d *DockerSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.followed = make(map[string]*dockerContainer)
+	d.lastSeen = make(map[string]time.Time)
+	d.lastListed = make(map[string]time.Time)
+
+	AcquisTomb.Go(func() error {
+		//the pending api calls are cancelled when acquisition is killed
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-AcquisTomb.Dying():
+				cancel()
+			case <-done:
+			}
+		}()
+		defer cancel()
+		if d.config.Mode == CATMODE {
+			return d.readAllContainers(ctx, output, AcquisTomb)
+		}
+		return d.watchContainers(ctx, output, AcquisTomb)
+	})
+	return nil
+}
+
+//readAllContainers reads the logs of the selected containers once, running or not
+func (d *DockerSource) readAllContainers(ctx context.Context, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	containers, err := d.client.ContainerList(ctx, dockerTypes.ContainerListOptions{All: true})
+	if err != nil {
+		return fmt.Errorf("while listing containers : %s", err)
+	}
+	for _, container := range containers {
+		name, ok := d.matchContainer(container)
+		if !ok {
+			continue
+		}
+		c := &dockerContainer{id: container.ID, name: name, labels: d.containerLabels(container, name)}
+		if err := d.readContainerLogs(ctx, c, dockerTypes.ContainerLogsOptions{Tail: "all"}, output, AcquisTomb); err != nil {
+			return err
+		}
+		select {
+		case <-AcquisTomb.Dying():
+			return nil
+		default:
+		}
+	}
+	return nil
+}
+
+func (d *DockerSource) watchContainers(ctx context.Context, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	//the logs of the containers already running when we start are followed from now on, the other ones from their start
+	if err := d.checkContainers(ctx, true, output, AcquisTomb); err != nil {
+		log.Errorf("%s : %s", d.Name(), err)
+	}
+	ticker := time.NewTicker(d.config.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-AcquisTomb.Dying():
+			return nil
+		case <-ticker.C:
+			if err := d.checkContainers(ctx, false, output, AcquisTomb); err != nil {
+				log.Errorf("%s : %s", d.Name(), err)
+			}
+		}
+	}
+}
+
+func (d *DockerSource) checkContainers(ctx context.Context, startup bool, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	containers, err := d.client.ContainerList(ctx, dockerTypes.ContainerListOptions{})
+	if err != nil {
+		return fmt.Errorf("while listing containers : %s", err)
+	}
+	running := make(map[string]bool)
+	for _, container := range containers {
+		name, ok := d.matchContainer(container)
+		if !ok {
+			continue
+		}
+		running[container.ID] = true
+		d.lock.Lock()
+		d.lastListed[container.ID] = time.Now()
+		_, followed := d.followed[container.ID]
+		lastSeen, seen := d.lastSeen[container.ID]
+		d.lock.Unlock()
+		if followed {
+			continue
+		}
+		options := dockerTypes.ContainerLogsOptions{Follow: true, Tail: "all"}
+		if startup {
+			options.Tail = "0"
+			d.lock.Lock()
+			d.lastSeen[container.ID] = time.Now()
+			d.lock.Unlock()
+		} else if seen {
+			//the container was restarted, don't read what we already read
+			since := lastSeen.Add(time.Nanosecond)
+			options.Since = fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())
+		}
+		log.Infof("start reading logs of container %s (%s)", name, container.ID)
+		containerCtx, cancel := context.WithCancel(ctx)
+		c := &dockerContainer{id: container.ID, name: name, labels: d.containerLabels(container, name), cancel: cancel}
+		d.lock.Lock()
+		d.followed[container.ID] = c
+		d.lock.Unlock()
+		AcquisTomb.Go(func() error {
+			defer func() {
+				d.lock.Lock()
+				delete(d.followed, c.id)
+				d.lock.Unlock()
+			}()
+			err := d.readContainerLogs(containerCtx, c, options, output, AcquisTomb)
+			//a container going away isn't an acquisition error
+			if err != nil {
+				log.Warningf("stop reading logs of container %s : %s", c.name, err)
+			}
+			return nil
+		})
+	}
+	//the log stream ends by itself when the container stops, but let's not rely on it
+	d.lock.Lock()
+	for id, c := range d.followed {
+		if !running[id] {
+			log.Infof("container %s is gone", c.name)
+			c.cancel()
+		}
+	}
+	//containers come and go : forget the ones that haven't been running for a while
+	for id, listed := range d.lastListed {
+		if !running[id] && time.Since(listed) > dockerForgetAfter {
+			delete(d.lastListed, id)
+			delete(d.lastSeen, id)
+		}
+	}
+	d.lock.Unlock()
+	return nil
+}
+
+//containerLabels are the labels of the events of a container : the configured ones, along with the container name and id
+func (d *DockerSource) containerLabels(container dockerTypes.Container, name string) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range d.config.Labels {
+		labels[k] = v
+	}
+	labels["container_name"] = name
+	labels["container_id"] = container.ID
+	return labels
+}
+
+func (d *DockerSource) readContainerLogs(ctx context.Context, c *dockerContainer, options dockerTypes.ContainerLogsOptions, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	clog := log.WithFields(log.Fields{
+		"container": c.name,
+	})
+	inspect, err := d.client.ContainerInspect(ctx, c.id)
+	if err != nil {
+		return fmt.Errorf("while inspecting container : %s", err)
+	}
+	options.ShowStdout = true
+	options.ShowStderr = true
+	options.Timestamps = true
+	reader, err := d.client.ContainerLogs(ctx, c.id, options)
+	if err != nil {
+		return fmt.Errorf("while reading logs : %s", err)
+	}
+	defer reader.Close()
+
+	var logs io.Reader = reader
+	//without tty, stdout and stderr are multiplexed
+	if inspect.Config == nil || !inspect.Config.Tty {
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pipeWriter, pipeWriter, reader)
+			pipeWriter.CloseWithError(err)
+		}()
+		defer pipeReader.Close()
+		logs = pipeReader
+	}
+	expectMode := leaky.LIVE
+	if d.config.Mode == CATMODE {
+		expectMode = leaky.TIMEMACHINE
+	}
+	count := 0
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		raw := strings.TrimRight(scanner.Text(), "\r")
+		ts := time.Now()
+		//with timestamps, each line is prefixed by its RFC3339Nano date
+		if idx := strings.IndexByte(raw, ' '); idx > 0 {
+			if parsed, err := time.Parse(time.RFC3339Nano, raw[:idx]); err == nil {
+				ts = parsed
+				raw = raw[idx+1:]
+			}
+		}
+		d.lock.Lock()
+		d.lastSeen[c.id] = ts
+		d.lock.Unlock()
+		if raw == "" {
+			continue
+		}
+		count++
+		ReaderHits.With(prometheus.Labels{"source": c.name}).Inc()
+		l := types.Line{}
+		l.Raw = raw
+		l.Time = ts
+		l.Src = c.name
+		l.Labels = c.labels
+		l.Process = true
+		select {
+		case output <- types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: expectMode}:
+		case <-AcquisTomb.Dying():
+			return nil
+		}
+	}
+	clog.Infof("read %d lines", count)
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
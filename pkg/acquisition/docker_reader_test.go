@@ -0,0 +1,251 @@
+package acquisition
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+//fakeDocker is a minimalist docker api : containers, their past logs and a chan to send new logs
+type fakeDocker struct {
+	containers []dockerTypes.Container
+	backlog    map[string][]string
+	live       map[string]chan string
+	lock       sync.Mutex
+}
+
+var apiPath = regexp.MustCompile(`^/v[0-9.]+(/.*)$`)
+var containerPath = regexp.MustCompile(`^/containers/([^/]+)/(json|logs)$`)
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if m := apiPath.FindStringSubmatch(path); m != nil {
+		path = m[1]
+	}
+	if path == "/_ping" {
+		w.Header().Set("API-Version", "1.40")
+		w.Write([]byte("OK"))
+		return
+	}
+	f.lock.Lock()
+	if path == "/containers/json" {
+		body, _ := json.Marshal(f.containers)
+		f.lock.Unlock()
+		w.Write(body)
+		return
+	}
+	m := containerPath.FindStringSubmatch(path)
+	if m == nil {
+		f.lock.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	id := m[1]
+	if m[2] == "json" {
+		f.lock.Unlock()
+		body, _ := json.Marshal(dockerTypes.ContainerJSON{ContainerJSONBase: &dockerTypes.ContainerJSONBase{ID: id}, Config: &container.Config{Tty: false}})
+		w.Write(body)
+		return
+	}
+	backlog := f.backlog[id]
+	live := f.live[id]
+	f.lock.Unlock()
+
+	//logs are multiplexed : stdout for the backlog, stderr for the live ones
+	w.WriteHeader(http.StatusOK)
+	if r.URL.Query().Get("tail") != "0" {
+		for _, line := range backlog {
+			stdcopy.NewStdWriter(w, stdcopy.Stdout).Write([]byte(time.Now().Format(time.RFC3339Nano) + " " + line + "\n"))
+		}
+	}
+	w.(http.Flusher).Flush()
+	if r.URL.Query().Get("follow") != "1" {
+		return
+	}
+	for {
+		select {
+		case line, ok := <-live:
+			if !ok {
+				return
+			}
+			stdcopy.NewStdWriter(w, stdcopy.Stderr).Write([]byte(time.Now().Format(time.RFC3339Nano) + " " + line + "\n"))
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (f *fakeDocker) addContainer(id string, name string, labels map[string]string, backlog []string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.containers = append(f.containers, dockerTypes.Container{ID: id, Names: []string{"/" + name}, Labels: labels})
+	f.backlog[id] = backlog
+	f.live[id] = make(chan string)
+}
+
+func (f *fakeDocker) stopContainer(id string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for idx, c := range f.containers {
+		if c.ID == id {
+			f.containers = append(f.containers[:idx], f.containers[idx+1:]...)
+			break
+		}
+	}
+	close(f.live[id])
+}
+
+func startFakeDocker(t *testing.T) (*fakeDocker, string, func()) {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeDocker{backlog: make(map[string][]string), live: make(map[string]chan string)}
+	server := httptest.NewUnstartedServer(fake)
+	server.Listener = listener
+	server.Start()
+	return fake, "unix://" + socket, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDockerTail(t *testing.T) {
+	fake, host, stop := startFakeDocker(t)
+	defer stop()
+	fake.addContainer("aaaa", "web-1", nil, []string{"old line"})
+	fake.addContainer("bbbb", "db", nil, []string{"not selected"})
+	defer func(delay time.Duration) { dockerForgetAfter = delay }(dockerForgetAfter)
+	dockerForgetAfter = 200 * time.Millisecond
+
+	source, err := DataSourceFromConfig([]byte(`type: docker
+docker_host: ` + host + `
+check_interval: 100ms
+container_name_regexp:
+ - ^web-
+labels:
+  type: nginx
+`))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	//the containers running at startup are read from now on
+	fake.live["aaaa"] <- "live line"
+	evts := readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "live line", evts[0].Line.Raw)
+	assert.Equal(t, "web-1", evts[0].Line.Src)
+	assert.Equal(t, map[string]string{"type": "nginx", "container_name": "web-1", "container_id": "aaaa"}, evts[0].Line.Labels)
+
+	//the containers started later on are read from their start
+	fake.addContainer("cccc", "web-2", nil, []string{"hello from web-2"})
+	evts = readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "hello from web-2", evts[0].Line.Raw)
+	assert.Equal(t, "web-2", evts[0].Line.Labels["container_name"])
+
+	fake.stopContainer("cccc")
+	time.Sleep(300 * time.Millisecond)
+	dockerSource := source.(*DockerSource)
+	dockerSource.lock.Lock()
+	assert.Equal(t, 1, len(dockerSource.followed))
+	dockerSource.lock.Unlock()
+
+	//the stopped container is eventually forgotten, the running one isn't
+	time.Sleep(300 * time.Millisecond)
+	dockerSource.lock.Lock()
+	_, seen := dockerSource.lastSeen["cccc"]
+	assert.False(t, seen)
+	_, seen = dockerSource.lastSeen["aaaa"]
+	assert.True(t, seen)
+	assert.Equal(t, 1, len(dockerSource.lastListed))
+	dockerSource.lock.Unlock()
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestDockerCat(t *testing.T) {
+	fake, host, stop := startFakeDocker(t)
+	defer stop()
+	fake.addContainer("aaaa", "web-1", map[string]string{"crowdsec": "yes"}, []string{"line 1", "line 2"})
+	fake.addContainer("bbbb", "web-2", nil, []string{"not selected"})
+
+	source, err := DataSourceFromConfig([]byte(`type: docker
+mode: cat
+docker_host: ` + host + `
+container_labels:
+  crowdsec: "yes"
+labels:
+  type: nginx
+`))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	evts := readEvents(output, 3)
+	if len(evts) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(evts))
+	}
+	assert.Equal(t, "line 1", evts[0].Line.Raw)
+	assert.Equal(t, "line 2", evts[1].Line.Raw)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestDockerConfigure(t *testing.T) {
+	_, err := DataSourceFromConfig([]byte("type: docker\nlabels:\n  type: nginx\n"))
+	assert.EqualError(t, err, "while configuring docker acquisition : no container_name, container_name_regexp or container_labels")
+	_, err = DataSourceFromConfig([]byte("type: docker\ncontainer_name_regexp:\n - ^(\nlabels:\n  type: nginx\n"))
+	assert.EqualError(t, err, "while configuring docker acquisition : invalid container_name_regexp '^(' : error parsing regexp: missing closing ): `^(`")
+}
+
+func TestDockerName(t *testing.T) {
+	source, err := DataSourceFromConfig([]byte("type: docker\ncontainer_name:\n - web\ncontainer_labels:\n  tier: front\n  app: shop\n  env: prod\nlabels:\n  type: nginx\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	//always the same, whatever the order of the labels
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "docker:web,app=shop,env=prod,tier=front", source.Name())
+	}
+}
@@ -2,15 +2,16 @@ package acquisition
 
 import (
 	"bufio"
+	"compress/bzip2"
 	"compress/gzip"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
 	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
 	"github.com/crowdsecurity/crowdsec/pkg/types"
 
@@ -25,330 +26,653 @@ import (
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/klauspost/compress/zstd"
 	"github.com/nxadm/tail"
+	"github.com/ulikunitz/xz"
 )
 
-type Acquisition interface {
-	Init(map[string]interface{}) (interface{}, error)
-	ReadOne(interface{}) (string, error)
-}
-
-type FileCtx struct {
-	Type      string   `yaml:"type,omitempty"` //file|bin|...
-	Mode      string   `yaml:"mode,omitempty"` //tail|cat|...
-	Filename  string   `yaml:"filename,omitempty"`
-	Filenames []string `yaml:"filenames,omitempty"`
-	tail      *tail.Tail
+const FILETYPE = "file"
 
-	Labels    map[string]string `yaml:"labels,omitempty"`
-	Profiling bool              `yaml:"profiling,omitempty"`
+type FileConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	Filename            string           `yaml:"filename,omitempty"`
+	Filenames           []string         `yaml:"filenames,omitempty"`
+	Multiline           *MultilineConfig `yaml:"multiline,omitempty"`
+	ContainerFormat     string           `yaml:"container_format,omitempty"` //cri, docker or auto, to unwrap the lines written by the container runtimes
 }
 
-type FileAcquisCtx struct {
-	Files     []FileCtx
-	Profiling bool
+/*FileSource reads the files matching `filename` and `filenames`, either in tail or cat mode*/
+type FileSource struct {
+	config    FileConfiguration
+	files     []string       //the files that matched the globs at configuration time
+	positions *PositionStore //optional, where to resume the tail of each file
+	pending   *positionQueue //when the source is buffered, holds back the positions of the buffered events
+	tails     map[string]*tail.Tail
+	tailIDs   map[string]fileID //the file each tail reads, it stops when the file is renamed or removed
+	resume    map[fileID]int64  //where to resume the files whose tail stopped, in case they show up under another name
+	tailsLock sync.Mutex
+	tailEnded chan bool //a tail stopped, the globs must be re-evaluated
+	watcher   *fsnotify.Watcher //watches the directories of the globs, nil if inotify isn't available
+	watched   map[string]bool
 }
 
-const (
-	TAILMODE = "tail"
-	CATMODE  = "cat"
-)
-
-const (
-	FILETYPE = "file"
-	BINTYPE  = "bin"
-)
+//GlobRescanInterval is how often the globs are re-evaluated in tail mode, in case inotify missed something
+var GlobRescanInterval = 30 * time.Second
 
-var ReaderHits = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "cs_reader_hits_total",
-		Help: "Total lines where read.",
+var TailedFiles = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "cs_reader_tailed_files",
+		Help: "Number of files currently tailed.",
 	},
-	[]string{"source"},
 )
 
-func LoadAcquisitionConfig(cConfig *csconfig.CrowdSec) (*FileAcquisCtx, error) {
-	var acquisitionCTX *FileAcquisCtx
-	var err error
-	/*Init the acqusition : from cli or from acquis.yaml file*/
-	if cConfig.SingleFile != "" {
-		var input FileCtx
-		input.Filename = cConfig.SingleFile
-		input.Mode = CATMODE
-		input.Labels = make(map[string]string)
-		input.Labels["type"] = cConfig.SingleFileLabel
-		acquisitionCTX, err = InitReaderFromFileCtx([]FileCtx{input})
-	} else { /* Init file reader if we tail */
-		acquisitionCTX, err = InitReader(cConfig.AcquisitionFile)
+func init() {
+	RegisterDataSource(FILETYPE, func() DataSource { return &FileSource{} })
+}
+
+func (f *FileSource) Configure(cfg []byte) error {
+	fileConfig := FileConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &fileConfig); err != nil {
+		return fmt.Errorf("while parsing file acquisition : %s", err)
 	}
-	if err != nil {
-		return nil, fmt.Errorf("unable to start file acquisition, bailout %v", err)
+	if fileConfig.Mode == "" {
+		fileConfig.Mode = TAILMODE
 	}
-	if acquisitionCTX == nil {
-		return nil, fmt.Errorf("no inputs to process")
+	if fileConfig.Mode != TAILMODE && fileConfig.Mode != CATMODE {
+		return fmt.Errorf("unknown read mode %s for %+v", fileConfig.Mode, fileConfig.Filenames)
 	}
-	if cConfig.Profiling {
-		acquisitionCTX.Profiling = true
+	if fileConfig.Filename == "" && len(fileConfig.Filenames) == 0 {
+		return fmt.Errorf("no filename or filenames")
 	}
-
-	return acquisitionCTX, nil
-}
-
-func InitReader(cfg string) (*FileAcquisCtx, error) {
-	var files []FileCtx
-
-	yamlFile, err := os.Open(cfg)
-	if err != nil {
-		log.Errorf("Can't access acquisition configuration file with '%v'.", err)
-		return nil, err
+	if fileConfig.Multiline != nil {
+		if err := fileConfig.Multiline.compile(); err != nil {
+			return err
+		}
 	}
-	//process the yaml
-	dec := yaml.NewDecoder(yamlFile)
-	dec.SetStrict(true)
-	for {
-		t := FileCtx{}
-		err = dec.Decode(&t)
+	if err := checkContainerFormat(fileConfig.ContainerFormat); err != nil {
+		return err
+	}
+	if len(fileConfig.Filename) > 0 {
+		fileConfig.Filenames = append(fileConfig.Filenames, fileConfig.Filename)
+		fileConfig.Filename = ""
+	}
+	f.config = fileConfig
+	f.files = []string{}
+	//resolve the globs
+	for _, fglob := range fileConfig.Filenames {
+		opcpt := 0
+		files, err := filepath.Glob(fglob)
 		if err != nil {
-			if err == io.EOF {
-				log.Tracef("End of yaml file")
-				break
+			log.Errorf("error while globing '%s' : %v", fglob, err)
+			return err
+		}
+		if len(files) == 0 {
+			if fileConfig.Mode == TAILMODE {
+				log.Warningf("nothing to glob for '%s' yet, waiting for files to show up", fglob)
+			} else {
+				log.Errorf("nothing to glob for '%s'", fglob)
 			}
-			log.Fatalf("Error decoding acquisition configuration file with '%s': %v", cfg, err)
-			break
+			continue
+		}
+		for _, file := range files {
+			/*check that we can read said file*/
+			if err := unix.Access(file, unix.R_OK); err != nil {
+				log.Errorf("Unable to open file [%s] : %v", file, err)
+				continue
+			}
+			log.Infof("Opening file '%s' (pattern:%s)", file, fglob)
+			f.files = append(f.files, file)
+			opcpt++
 		}
-		files = append(files, t)
+		log.Debugf("'%s' opened %d files", fglob, opcpt)
 	}
-	return InitReaderFromFileCtx(files)
+	return nil
 }
 
-//InitReader iterates over the FileCtx objects of cfg and resolves globbing to open files
-func InitReaderFromFileCtx(files []FileCtx) (*FileAcquisCtx, error) {
+func (f *FileSource) Mode() string {
+	return f.config.Mode
+}
 
-	var ctx *FileAcquisCtx = &FileAcquisCtx{}
+func (f *FileSource) Name() string {
+	return fmt.Sprintf("file:%s", strings.Join(f.config.Filenames, ","))
+}
 
-	for _, t := range files {
-		//defaults to file type in tail mode.
-		if t.Type == "" {
-			t.Type = FILETYPE
+func (f *FileSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	if f.config.Mode == TAILMODE {
+		f.tails = make(map[string]*tail.Tail)
+		f.tailIDs = make(map[string]fileID)
+		f.resume = make(map[fileID]int64)
+		f.tailEnded = make(chan bool, 1)
+		for _, file := range f.files {
+			id, err := fileIdentity(file)
+			if err != nil {
+				log.Errorf("skipping '%s' : %v", file, err)
+				continue
+			}
+			location := &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
+			if f.positions != nil {
+				location = f.positions.StartPosition(file)
+			}
+			f.startTail(file, id, location, output, AcquisTomb)
 		}
-		if t.Mode == "" {
-			t.Mode = TAILMODE
+		//files matching the globs can show up (or go away) later on
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Warningf("unable to watch directories of %s, falling back to polling : %s", f.Name(), err)
+		} else {
+			f.watcher = watcher
+			f.watched = make(map[string]bool)
+			f.addWatches()
 		}
-		//minimalist sanity check
-		if t.Filename == "" && len(t.Filenames) == 0 {
-			log.Infof("No filename or filenames, skipping empty item %+v", t)
-			continue
+		AcquisTomb.Go(func() error {
+			return f.watchGlobs(output, AcquisTomb)
+		})
+		return nil
+	}
+	if len(f.files) == 0 {
+		log.Errorf("No files to read for %s", f.Name())
+	}
+	/*the files are read one after the other, the oldest first, so that the time-machine buckets see the events in sequence*/
+	files := sortByModTime(f.files)
+	AcquisTomb.Go(func() error {
+		summary := make([]string, 0, len(files))
+		total := 0
+		for _, file := range files {
+			count, err := ReadAtOnce(file, f.config.Labels, f.config.Multiline, f.config.ContainerFormat, output, AcquisTomb)
+			//a corrupted archive shouldn't prevent reading the other files
+			if err != nil {
+				summary = append(summary, fmt.Sprintf("%s: %d (%s)", file, count, err))
+			} else {
+				summary = append(summary, fmt.Sprintf("%s: %d", file, count))
+			}
+			total += count
+			select {
+			case <-AcquisTomb.Dying():
+				return nil
+			default:
+			}
 		}
-		if len(t.Labels) == 0 {
-			log.Infof("Acquisition has no tags, skipping empty item %+v", t)
-			continue
+		if len(files) > 1 {
+			log.Infof("read %d lines from %d files (%s)", total, len(files), strings.Join(summary, ", "))
+		}
+		return nil
+	})
+	return nil
+}
+
+//sortByModTime returns the files sorted by modification time, rotated logs thus come before the current one
+func sortByModTime(files []string) []string {
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
 		}
+	}
+	sorted := append([]string{}, files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return modTimes[sorted[i]].Before(modTimes[sorted[j]])
+	})
+	return sorted
+}
 
-		if len(t.Filename) > 0 {
-			t.Filenames = append(t.Filenames, t.Filename)
+/*
+ startTail tails file until it's renamed or removed : the globs decide what to read next, as a rotated file
+ can still be matched under its new name (ie. access.log.1), and must then be read from where its tail stopped.
+*/
+func (f *FileSource) startTail(file string, id fileID, location *tail.SeekInfo, output chan types.Event, AcquisTomb *tomb.Tomb) {
+	t, err := tail.TailFile(file, tail.Config{ReOpen: false, Follow: true, Poll: true, Location: location})
+	if err != nil {
+		log.Errorf("skipping '%s' : %v", file, err)
+		return
+	}
+	f.tailsLock.Lock()
+	f.tails[file] = t
+	f.tailIDs[file] = id
+	delete(f.resume, id)
+	f.tailsLock.Unlock()
+	TailedFiles.Inc()
+	//where the tail starts, if it stops before sending anything
+	startOffset := location.Offset
+	if location.Whence == io.SeekEnd {
+		if _, size, err := fileInode(file); err == nil {
+			startOffset = size
+		}
+	}
+	AcquisTomb.Go(func() error {
+		offset, err := AcquisReadOneFile(t, file, f.config.Labels, f.config.Multiline, f.config.ContainerFormat, f.positions, f.pending, output, AcquisTomb)
+		if offset < 0 {
+			offset = startOffset
 		}
-		var opcpt int
-		//open the files indicated by `filename` and `filesnames`
-		for _, fglob := range t.Filenames {
-			opcpt = 0
-			files, err := filepath.Glob(fglob)
+		f.tailsLock.Lock()
+		if f.tails[file] == t {
+			delete(f.tails, file)
+			delete(f.tailIDs, file)
+		}
+		f.resume[id] = offset
+		f.tailsLock.Unlock()
+		TailedFiles.Dec()
+		select {
+		case f.tailEnded <- true:
+		default:
+		}
+		return err
+	})
+}
+
+/*
+ rescanGlobs starts tailing the files that appeared since last time. The files are identified by their inode :
+  - a file that was never seen is read from the start
+  - a file that was renamed (ie. from access.log to access.log.1) is read from where its tail stopped, once it did
+*/
+func (f *FileSource) rescanGlobs(output chan types.Event, AcquisTomb *tomb.Tomb) {
+	matched := make(map[string]fileID)
+	for _, fglob := range f.config.Filenames {
+		//the patterns were validated at configuration time
+		files, _ := filepath.Glob(fglob)
+		for _, file := range files {
+			if err := unix.Access(file, unix.R_OK); err != nil {
+				log.Debugf("Unable to open file [%s] : %v", file, err)
+				continue
+			}
+			id, err := fileIdentity(file)
 			if err != nil {
-				log.Errorf("error while globing '%s' : %v", fglob, err)
-				return nil, err
+				log.Debugf("Unable to stat file [%s] : %v", file, err)
+				continue
 			}
-			if len(files) == 0 {
-				log.Errorf("nothing to glob for '%s'", fglob)
+			matched[file] = id
+		}
+	}
+
+	type newFile struct {
+		file     string
+		id       fileID
+		location *tail.SeekInfo
+	}
+	var appeared []newFile
+
+	f.tailsLock.Lock()
+	tailed := make(map[fileID]bool, len(f.tailIDs))
+	for _, id := range f.tailIDs {
+		tailed[id] = true
+	}
+	present := make(map[fileID]bool, len(matched))
+	for file, id := range matched {
+		present[id] = true
+		//the file (or the previous one of this name) is still being read, until it's drained
+		if _, ok := f.tails[file]; ok || tailed[id] {
+			continue
+		}
+		if offset, ok := f.resume[id]; ok {
+			log.Infof("'%s' was renamed, resume tailing it at offset %d", file, offset)
+			appeared = append(appeared, newFile{file, id, &tail.SeekInfo{Offset: offset, Whence: io.SeekStart}})
+			continue
+		}
+		//files showing up while we're running are read from the start, unless we already know them
+		location := &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+		if f.positions != nil {
+			if _, ok := f.positions.Get(file); ok {
+				location = f.positions.StartPosition(file)
+			}
+		}
+		log.Infof("new file '%s', start tailing it", file)
+		appeared = append(appeared, newFile{file, id, location})
+	}
+	//forget the files that are gone, or don't match the globs anymore
+	for id := range f.resume {
+		if !present[id] {
+			delete(f.resume, id)
+		}
+	}
+	f.tailsLock.Unlock()
+
+	for _, newFile := range appeared {
+		f.startTail(newFile.file, newFile.id, newFile.location, output, AcquisTomb)
+	}
+}
+
+func (f *FileSource) addWatches() {
+	if f.watcher == nil {
+		return
+	}
+	for _, fglob := range f.config.Filenames {
+		dirs, _ := filepath.Glob(filepath.Dir(fglob))
+		for _, dir := range dirs {
+			if f.watched[dir] {
 				continue
 			}
-			for _, file := range files {
-				/*check that we can read said file*/
-				if err := unix.Access(file, unix.R_OK); err != nil {
-					log.Errorf("Unable to open file [%s] : %v", file, err)
-					continue
-				}
-				log.Infof("Opening file '%s' (pattern:%s)", file, fglob)
-				fdesc := t
-				fdesc.Filename = file
-				fdesc.Filenames = []string{}
-
-				switch t.Type {
-				case FILETYPE:
-					if t.Mode == TAILMODE {
-						fdesc.tail, err = tail.TailFile(file, tail.Config{ReOpen: true, Follow: true, Poll: true, Location: &tail.SeekInfo{Offset: 0, Whence: 2}})
-						if err != nil {
-							log.Errorf("skipping '%s' : %v", file, err)
-							continue
-						}
-					}
-				case BINTYPE:
-
-				default:
-					log.Fatalf("unexpected type %s for %+v", t.Type, t.Filenames)
-				}
-				opcpt++
-				ctx.Files = append(ctx.Files, fdesc)
+			if err := f.watcher.Add(dir); err != nil {
+				log.Warningf("unable to watch '%s', falling back to polling : %s", dir, err)
 			}
+			f.watched[dir] = true
 		}
-		log.Debugf("'%v' opened %d files", t.Filenames, opcpt)
 	}
-	return ctx, nil
 }
 
-//let's return an array of chans for signaling for now
-func AcquisStartReading(ctx *FileAcquisCtx, output chan types.Event, AcquisTomb *tomb.Tomb) {
-
-	if len(ctx.Files) == 0 {
-		log.Errorf("No files to read")
-	}
-	/* start one go routine reading for each file, and pushing to chan output */
-	for idx, fctx := range ctx.Files {
-		if ctx.Profiling {
-			fctx.Profiling = true
-		}
-		fctx := fctx
-		mode := "?"
-		switch fctx.Mode {
-		case TAILMODE:
-			mode = "tail"
-			AcquisTomb.Go(func() error {
-				return AcquisReadOneFile(fctx, output, AcquisTomb)
-			})
-		case CATMODE:
-			mode = "cat"
-			AcquisTomb.Go(func() error {
-				return ReadAtOnce(fctx, output, AcquisTomb)
-			})
-		default:
-			log.Fatalf("unknown read mode %s for %+v", fctx.Mode, fctx.Filenames)
+/*
+ watchGlobs re-evaluates the globs whenever something is created or removed in the directories they point to,
+ and when a tail stopped because its file was renamed or removed. inotify can be unavailable (or exhausted), so the globs are also re-evaluated every GlobRescanInterval.
+*/
+func (f *FileSource) watchGlobs(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	var events chan fsnotify.Event
+	var watchErrors chan error
+
+	if f.watcher != nil {
+		defer f.watcher.Close()
+		events = f.watcher.Events
+		watchErrors = f.watcher.Errors
+	}
+	ticker := time.NewTicker(GlobRescanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-AcquisTomb.Dying():
+			return nil
+		case evt := <-events:
+			if evt.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			//the watch of a removed directory is dropped, it has to be added again if it comes back
+			if f.watched[evt.Name] && evt.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				delete(f.watched, evt.Name)
+			}
+			f.addWatches()
+			f.rescanGlobs(output, AcquisTomb)
+		case err := <-watchErrors:
+			log.Warningf("error while watching directories of %s : %s", f.Name(), err)
+		case <-f.tailEnded:
+			f.rescanGlobs(output, AcquisTomb)
+		case <-ticker.C:
+			f.addWatches()
+			f.rescanGlobs(output, AcquisTomb)
 		}
-		log.Printf("starting (%s) reader file %d/%d : %s", mode, idx, len(ctx.Files), fctx.Filename)
 	}
-	log.Printf("Started %d routines for polling/read", len(ctx.Files))
 }
 
-/*A tail-mode file reader (tail) */
-func AcquisReadOneFile(ctx FileCtx, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+/*
+ A tail-mode file reader (tail), multiline, positions and pending can be nil. It returns the offset
+ to resume reading from (the end of the last event sent), or -1 if no event was sent.
+*/
+func AcquisReadOneFile(t *tail.Tail, filename string, labels map[string]string, multiline *MultilineConfig, containerFormat string, positions *PositionStore, pending *positionQueue, output chan types.Event, AcquisTomb *tomb.Tomb) (int64, error) {
+	var pos FilePosition
+	var err error
+	var resumeOffset int64 = -1
+	var ml *Multiline
+	var cd *ContainerDecoder
+	var lastOffset, lineStart int64
+	var lastLine time.Time
+
 	clog := log.WithFields(log.Fields{
-		"acquisition file": ctx.Filename,
+		"acquisition file": filename,
 	})
-	if ctx.Type != FILETYPE {
-		log.Errorf("Can't tail %s type for %+v", ctx.Type, ctx.Filenames)
-		return fmt.Errorf("can't tail %s type for %+v", ctx.Type, ctx.Filenames)
+	log.Infof("Starting tail of %s", filename)
+	if positions != nil {
+		if pos.Inode, _, err = fileInode(filename); err != nil {
+			clog.Warningf("can't stat file, position won't be saved : %s", err)
+			positions = nil
+		}
+	}
+	//savePosition stores the offset, or queues it until the event before it left the buffer
+	savePosition := func(offset int64, sending bool) {
+		resumeOffset = offset
+		if positions == nil {
+			return
+		}
+		//the offset went backward : the tailer re-opened a truncated file
+		if offset < pos.Offset {
+			if inode, _, err := fileInode(filename); err == nil {
+				pos.Inode = inode
+			}
+		}
+		pos.Offset = offset
+		switch {
+		case pending == nil:
+			positions.Set(filename, pos)
+		case sending:
+			pending.Sent(filename, pos)
+		default:
+			pending.Set(filename, pos)
+		}
+	}
+	if containerFormat != "" {
+		cd = NewContainerDecoder(containerFormat)
 	}
-	log.Infof("Starting tail of %s", ctx.Filename)
-	timeout := time.Tick(20 * time.Second)
+	//sendLine sends the event, and saves the offset that follows it
+	sendLine := func(raw string, ts time.Time, offset int64) bool {
+		l := types.Line{}
+		l.Raw = raw
+		l.Labels = labels
+		l.Time = ts
+		l.Src = filename
+		l.Process = true
+		//we're tailing, it must be real time logs
+		evt := types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.LIVE}
+		if cd != nil {
+			//the runtime timestamp, for the date parsers
+			evt.StrTime = ts.Format(time.RFC3339Nano)
+		}
+		//the event may leave the buffer as soon as it's sent
+		if pending != nil {
+			savePosition(offset, true)
+		}
+		select {
+		case output <- evt:
+			if pending == nil {
+				savePosition(offset, false)
+			}
+			return true
+		case <-AcquisTomb.Dying():
+			return false
+		}
+	}
+	tick := 20 * time.Second
+	if multiline != nil {
+		ml = NewMultiline(multiline)
+		//the pending event is flushed on timeout
+		tick = multiline.FlushTimeout / 2
+	}
+	timeout := time.NewTicker(tick)
+	defer timeout.Stop()
 LOOP:
 	for {
-		l := types.Line{}
 		select {
 		case <-AcquisTomb.Dying(): //we are being killed by main
 			clog.Infof("Killing acquistion routine")
-			if err := ctx.tail.Stop(); err != nil {
+			if err := t.Stop(); err != nil {
 				clog.Errorf("error in stop : %s", err)
 			}
 			break LOOP
-		case <-ctx.tail.Tomb.Dying(): //our tailer is dying
+		case <-t.Tomb.Dying(): //our tailer is dying
+			//it was stopped because the file is gone
+			if t.Err() == nil {
+				clog.Infof("tail is stopped")
+				return resumeOffset, nil
+			}
 			clog.Warningf("Reader is dying/dead")
-			return errors.New("reader is dead")
-		case line := <-ctx.tail.Lines:
+			return resumeOffset, errors.New("reader is dead")
+		case line := <-t.Lines:
 			if line == nil {
+				if err := t.Wait(); err == nil {
+					clog.Infof("tail is stopped")
+					return resumeOffset, nil
+				}
 				clog.Debugf("Nil line")
-				return errors.New("Tail is empty")
+				return resumeOffset, errors.New("Tail is empty")
 			}
 			if line.Err != nil {
 				log.Warningf("fetch error : %v", line.Err)
-				return line.Err
+				return resumeOffset, line.Err
 			}
 			if line.Text == "" { //skip empty lines
 				continue
 			}
-			ReaderHits.With(prometheus.Labels{"source": ctx.Filename}).Inc()
-
-			l.Raw = line.Text
-			l.Labels = ctx.Labels
-			l.Time = line.Time
-			l.Src = ctx.Filename
-			l.Process = true
-			//we're tailing, it must be real time logs
-			output <- types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.LIVE}
-		case <-timeout:
+			ReaderHits.With(prometheus.Labels{"source": filename}).Inc()
+			//where the line, or its first part, starts
+			if cd == nil || !cd.Pending() {
+				lineStart = lastOffset
+			}
+			lastOffset = line.SeekInfo.Offset
+			text, ts := line.Text, line.Time
+			if cd != nil {
+				var ok bool
+				if text, ts, ok = cd.Decode(line.Text, line.Time); !ok {
+					//partial line, wait for the rest
+					continue
+				}
+				if text == "" {
+					continue
+				}
+			}
+			if ml == nil {
+				sendLine(text, ts, lastOffset)
+				continue
+			}
+			lastLine = time.Now()
+			//don't save the offset in the middle of an event, or we would only get its end on restart
+			if raw, ts, ok := ml.Add(text, ts); ok {
+				offset := lastOffset
+				if ml.Len() == 1 { //this line started the next event
+					offset = lineStart
+				}
+				sendLine(raw, ts, offset)
+			} else if ml.Len() == 1 { //this line started the pending event
+				savePosition(lineStart, false)
+			}
+		case <-timeout.C:
+			if ml != nil && ml.Len() > 0 && time.Since(lastLine) >= multiline.FlushTimeout {
+				raw, ts, _ := ml.Flush()
+				sendLine(raw, ts, lastOffset)
+				continue
+			}
 			//time out, shall we do stuff ?
 			clog.Tracef("timeout")
 		}
 	}
-	return nil
+	return resumeOffset, nil
 }
 
-/*A one shot file reader (cat) */
-func ReadAtOnce(ctx FileCtx, output chan types.Event, AcquisTomb *tomb.Tomb) error {
-	var scanner *bufio.Scanner
-
-	if len(ctx.Filenames) > 0 {
-		log.Errorf("no multi-file support for this mode.")
-		return fmt.Errorf("no multi-file support for this mode")
+/*openDecompressed returns a reader on the content of the file, decompressed according to its extension*/
+func openDecompressed(file string, fd io.Reader) (io.Reader, func(), error) {
+	switch {
+	case strings.HasSuffix(file, ".gz"):
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read gz file : %s", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	case strings.HasSuffix(file, ".bz2"):
+		return bzip2.NewReader(fd), func() {}, nil
+	case strings.HasSuffix(file, ".xz"):
+		xzReader, err := xz.NewReader(fd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read xz file : %s", err)
+		}
+		return xzReader, func() {}, nil
+	case strings.HasSuffix(file, ".zst"):
+		zstReader, err := zstd.NewReader(fd)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read zst file : %s", err)
+		}
+		return zstReader, zstReader.Close, nil
 	}
-	log.Infof("reading %s at once", ctx.Filename)
-	file := ctx.Filename
+	return fd, func() {}, nil
+}
+
+/*A one shot file reader (cat), returns the number of lines read*/
+func ReadAtOnce(file string, labels map[string]string, multiline *MultilineConfig, containerFormat string, output chan types.Event, AcquisTomb *tomb.Tomb) (int, error) {
+	var ml *Multiline
+	var cd *ContainerDecoder
+
+	log.Infof("reading %s at once", file)
 
 	clog := log.WithFields(log.Fields{
 		"file": file,
 	})
 	fd, err := os.Open(file)
-	defer fd.Close()
 	if err != nil {
 		clog.Errorf("Failed opening file: %s", err)
-		return err
+		return 0, err
 	}
+	defer fd.Close()
 
-	if ctx.Type == FILETYPE {
-		if strings.HasSuffix(file, ".gz") {
-			gz, err := gzip.NewReader(fd)
-			if err != nil {
-				clog.Errorf("Failed to read gz file: %s", err)
-				return err
-			}
-			defer gz.Close()
-			scanner = bufio.NewScanner(gz)
-
-		} else {
-			scanner = bufio.NewScanner(fd)
-		}
-		scanner.Split(bufio.ScanLines)
-		count := 0
-		for scanner.Scan() {
-			count++
-			l := types.Line{}
-			l.Raw = scanner.Text()
-			l.Time = time.Now()
-			l.Src = file
-			l.Labels = ctx.Labels
-			l.Process = true
-			//we're reading logs at once, it must be time-machine buckets
-			output <- types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.TIMEMACHINE}
-		}
-		clog.Warningf("read %d lines", count)
-	} else if ctx.Type == BINTYPE {
-		/*BINTYPE is only overflows for now*/
-		dec := json.NewDecoder(fd)
-		count := 0
-		for {
-			var p types.Event
-			if err := dec.Decode(&p); err == io.EOF {
-				break
-			} else if err != nil {
-				log.Warningf("While reading %s : %s", fd.Name(), err)
+	reader, closeReader, err := openDecompressed(file, fd)
+	if err != nil {
+		clog.Errorf("%s", err)
+		return 0, err
+	}
+	defer closeReader()
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanLines)
+	if multiline != nil {
+		ml = NewMultiline(multiline)
+	}
+	if containerFormat != "" {
+		cd = NewContainerDecoder(containerFormat)
+	}
+	count := 0
+	sendLine := func(raw string, ts time.Time) bool {
+		l := types.Line{}
+		l.Raw = raw
+		l.Time = ts
+		l.Src = file
+		l.Labels = labels
+		l.Process = true
+		//we're reading logs at once, it must be time-machine buckets
+		evt := types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.TIMEMACHINE}
+		if cd != nil {
+			//the runtime timestamp, for the date parsers
+			evt.StrTime = ts.Format(time.RFC3339Nano)
+		}
+		select {
+		case output <- evt:
+			return true
+		case <-AcquisTomb.Dying():
+			clog.Infof("acquisition is dying, stop reading after %d lines", count)
+			return false
+		}
+	}
+	//feeds a complete line to multiline, if any
+	handleLine := func(text string, ts time.Time) bool {
+		if ml == nil {
+			return sendLine(text, ts)
+		}
+		if raw, evtTime, ok := ml.Add(text, ts); ok {
+			return sendLine(raw, evtTime)
+		}
+		return true
+	}
+	for scanner.Scan() {
+		count++
+		text, ts := scanner.Text(), time.Now()
+		if cd != nil {
+			var ok bool
+			if text, ts, ok = cd.Decode(text, ts); !ok || text == "" {
 				continue
 			}
-			count++
-			p.Type = types.OVFLW
-			p.Process = true
-			//we're reading logs at once, it must be time-machine buckets
-			p.ExpectMode = leaky.TIMEMACHINE
-			output <- p
 		}
-		clog.Warningf("unmarshaled %d events", count)
-
+		if !handleLine(text, ts) {
+			return count, nil
+		}
 	}
-	clog.Infof("force commit")
-	return nil
+	if cd != nil {
+		//a partial line without its end
+		if text, ts, ok := cd.Flush(); ok {
+			if !handleLine(text, ts) {
+				return count, nil
+			}
+		}
+	}
+	if ml != nil {
+		if raw, ts, ok := ml.Flush(); ok {
+			if !sendLine(raw, ts) {
+				return count, nil
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		clog.Errorf("error while reading : %s", err)
+		return count, err
+	}
+	clog.Warningf("read %d lines", count)
+	return count, nil
 }
@@ -2,7 +2,10 @@ package acquisition
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 	"time"
 
@@ -18,7 +21,7 @@ func TestLoadAcquisitionConfig(t *testing.T) {
 
 	tests := []struct {
 		csConfig *csconfig.CrowdSec
-		result   *FileAcquisCtx
+		result   *AcquisCtx
 		err      string
 	}{
 		{
@@ -27,17 +30,21 @@ func TestLoadAcquisitionConfig(t *testing.T) {
 				SingleFileLabel: "my_test_log",
 				Profiling:       false,
 			},
-			result: &FileAcquisCtx{
-				Files: []FileCtx{
-					{
-						Type:      "file",
-						Mode:      "cat",
-						Filename:  testFilePath,
-						Filenames: []string{},
-						Labels: map[string]string{
-							"type": "my_test_log",
+			result: &AcquisCtx{
+				Sources: []DataSource{
+					&FileSource{
+						config: FileConfiguration{
+							DataSourceCommonCfg: DataSourceCommonCfg{
+								Type: "file",
+								Mode: "cat",
+								Labels: map[string]string{
+									"type": "my_test_log",
+								},
+								Profiling: false,
+							},
+							Filenames: []string{testFilePath},
 						},
-						Profiling: false,
+						files: []string{testFilePath},
 					},
 				},
 				Profiling: false,
@@ -50,23 +57,50 @@ func TestLoadAcquisitionConfig(t *testing.T) {
 				SingleFileLabel: "my_test_log",
 				Profiling:       true,
 			},
-			result: &FileAcquisCtx{
-				Files: []FileCtx{
-					{
-						Type:      "file",
-						Mode:      "cat",
-						Filename:  testFilePath,
-						Filenames: []string{},
-						Labels: map[string]string{
-							"type": "my_test_log",
+			result: &AcquisCtx{
+				Sources: []DataSource{
+					&FileSource{
+						config: FileConfiguration{
+							DataSourceCommonCfg: DataSourceCommonCfg{
+								Type: "file",
+								Mode: "cat",
+								Labels: map[string]string{
+									"type": "my_test_log",
+								},
+								Profiling: false,
+							},
+							Filenames: []string{testFilePath},
 						},
-						Profiling: false,
+						files: []string{testFilePath},
 					},
 				},
 				Profiling: true,
 			},
 			err: "",
 		},
+		{
+			csConfig: &csconfig.CrowdSec{
+				SingleFile:      "-",
+				SingleFileLabel: "my_test_log",
+			},
+			result: &AcquisCtx{
+				Sources: []DataSource{
+					&PipeSource{
+						config: PipeConfiguration{
+							DataSourceCommonCfg: DataSourceCommonCfg{
+								Type: "pipe",
+								Mode: "cat",
+								Labels: map[string]string{
+									"type": "my_test_log",
+								},
+							},
+							Filename: "-",
+						},
+					},
+				},
+			},
+			err: "",
+		},
 	}
 
 	for _, test := range tests {
@@ -313,3 +347,175 @@ L:
 		t.Fatal()
 	}
 }
+
+func TestTailGlobNewFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("already there\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := DataSourceFromConfig([]byte("filename: " + dir + "/*.log\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	fileSource := source.(*FileSource)
+	tailedCount := func() int {
+		fileSource.tailsLock.Lock()
+		defer fileSource.tailsLock.Unlock()
+		return len(fileSource.tails)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	assert.Equal(t, 1, tailedCount())
+
+	//a new file matching the glob is read from the start
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.log"), []byte("new file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	//not matching the glob
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("ignored\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	evts := readEvents(output, 2)
+	assert.Equal(t, 1, len(evts))
+	if len(evts) == 1 {
+		assert.Equal(t, "new file", evts[0].Line.Raw)
+		assert.Equal(t, filepath.Join(dir, "b.log"), evts[0].Line.Src)
+	}
+	assert.Equal(t, 2, tailedCount())
+
+	//removed files aren't tailed anymore
+	if err := os.Remove(filepath.Join(dir, "b.log")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20 && tailedCount() != 1; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, 1, tailedCount())
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	assert.Equal(t, 0, tailedCount())
+}
+
+func TestTailGlobRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	current := filepath.Join(dir, "access.log")
+	rotated := filepath.Join(dir, "access.log.1")
+	appendLine := func(file string, line string) {
+		fd, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fd.Close()
+		if _, err := fd.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appendLine(current, "before start")
+	source, err := DataSourceFromConfig([]byte("filename: " + dir + "/access.log*\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	appendLine(current, "line 1")
+	evts := readEvents(output, 1)
+	if len(evts) != 1 || evts[0].Line.Raw != "line 1" {
+		t.Fatalf("unexpected events %+v", evts)
+	}
+
+	//the rotated file is still written to for a while, and isn't read again from the start
+	if err := os.Rename(current, rotated); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(rotated, "line 2")
+	time.Sleep(500 * time.Millisecond)
+	appendLine(current, "line 3")
+	time.Sleep(500 * time.Millisecond)
+	appendLine(rotated, "line 4")
+
+	raws := []string{}
+	for _, evt := range readEvents(output, 4) {
+		raws = append(raws, evt.Line.Raw)
+	}
+	sort.Strings(raws)
+	assert.Equal(t, []string{"line 2", "line 3", "line 4"}, raws)
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestCatRotatedFiles(t *testing.T) {
+	//the order in which the files were rotated, oldest first
+	rotated := []string{"access.log.4.bz2", "access.log.3.xz", "access.log.2.zst", "access.log.1.gz", "access.log"}
+	//the mtimes are set on copies, not to alter the fixtures
+	dir, err := ioutil.TempDir("", "rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	for idx, file := range rotated {
+		data, err := ioutil.ReadFile(filepath.Join("./tests/rotated", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(idx-len(rotated)) * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, file), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	csConfig := &csconfig.CrowdSec{
+		SingleFile:      filepath.Join(dir, "access.log*"),
+		SingleFileLabel: "my_test_log",
+	}
+	fCTX, err := LoadAcquisitionConfig(csConfig)
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	AcquisStartReading(fCTX, output, &acquisTomb)
+
+	evts := readEvents(output, 8)
+	raws := []string{}
+	for _, evt := range evts {
+		raws = append(raws, evt.Line.Raw)
+	}
+	assert.Equal(t, []string{
+		"line 1 from bz2",
+		"line 2 from bz2",
+		"line 1 from xz",
+		"line 1 from zst",
+		"line 2 from zst",
+		"line 1 from gz",
+		"line 1 from plain",
+	}, raws)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
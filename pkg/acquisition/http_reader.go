@@ -0,0 +1,285 @@
+package acquisition
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const HTTPTYPE = "http"
+
+type HTTPConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	ListenAddr          string        `yaml:"listen_addr,omitempty"`
+	ListenPort          int           `yaml:"listen_port,omitempty"`
+	Path                string        `yaml:"path,omitempty"`
+	SecretHeader        string        `yaml:"secret_header,omitempty"`
+	Secret              string        `yaml:"secret,omitempty"`
+	MaxBodySize         int64         `yaml:"max_body_size,omitempty"`
+	QueueTimeout        time.Duration `yaml:"queue_timeout,omitempty"` //how long a batch can wait for the parsers before being rejected
+	CertFile            string        `yaml:"cert_file,omitempty"`
+	KeyFile             string        `yaml:"key_file,omitempty"`
+}
+
+/*
+ HTTPSource is an http server receiving batches of events pushed by the applications.
+ The body is either newline-delimited json (application/x-ndjson or application/json), or plain text lines.
+ When the parsers can't keep up, the batch is rejected with a 503 and the client is expected to retry the records that weren't accepted.
+*/
+type HTTPSource struct {
+	config   HTTPConfiguration
+	listener net.Listener
+	server   *http.Server
+}
+
+var HTTPRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cs_http_acquisition_rejected_total",
+		Help: "Total batches rejected by the http acquisition.",
+	},
+	[]string{"reason"},
+)
+
+func init() {
+	RegisterDataSource(HTTPTYPE, func() DataSource { return &HTTPSource{} })
+}
+
+func (h *HTTPSource) Configure(cfg []byte) error {
+	httpConfig := HTTPConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &httpConfig); err != nil {
+		return fmt.Errorf("while parsing http acquisition : %s", err)
+	}
+	if httpConfig.Mode == "" {
+		httpConfig.Mode = TAILMODE
+	}
+	if httpConfig.Mode != TAILMODE {
+		return fmt.Errorf("http acquisition only supports %s mode", TAILMODE)
+	}
+	if httpConfig.Secret == "" {
+		return fmt.Errorf("secret is mandatory")
+	}
+	if (httpConfig.CertFile == "") != (httpConfig.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if httpConfig.ListenAddr == "" {
+		httpConfig.ListenAddr = "127.0.0.1"
+	}
+	if httpConfig.ListenPort == 0 {
+		httpConfig.ListenPort = 8081
+	}
+	if httpConfig.Path == "" {
+		httpConfig.Path = "/"
+	}
+	if httpConfig.SecretHeader == "" {
+		httpConfig.SecretHeader = "X-Crowdsec-Secret"
+	}
+	if httpConfig.MaxBodySize == 0 {
+		httpConfig.MaxBodySize = 10 * 1024 * 1024
+	}
+	if httpConfig.QueueTimeout == 0 {
+		httpConfig.QueueTimeout = time.Second
+	}
+	h.config = httpConfig
+	return nil
+}
+
+func (h *HTTPSource) Mode() string {
+	return h.config.Mode
+}
+
+func (h *HTTPSource) Name() string {
+	return fmt.Sprintf("http:%s%s", h.listenAddr(), h.config.Path)
+}
+
+func (h *HTTPSource) listenAddr() string {
+	return net.JoinHostPort(h.config.ListenAddr, strconv.Itoa(h.config.ListenPort))
+}
+
+func (h *HTTPSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	var err error
+
+	h.listener, err = net.Listen("tcp", h.listenAddr())
+	if err != nil {
+		return fmt.Errorf("while listening on %s : %s", h.listenAddr(), err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(h.config.Path, func(w http.ResponseWriter, r *http.Request) {
+		h.handleBatch(w, r, output, AcquisTomb)
+	})
+	h.server = &http.Server{Handler: mux, ReadTimeout: 30 * time.Second, WriteTimeout: 30 * time.Second}
+	AcquisTomb.Go(func() error {
+		var err error
+
+		log.Infof("Starting http acquisition on %s", h.Name())
+		if h.config.CertFile != "" {
+			err = h.server.ServeTLS(h.listener, h.config.CertFile, h.config.KeyFile)
+		} else {
+			err = h.server.Serve(h.listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("http acquisition on %s : %s", h.listenAddr(), err)
+		}
+		return nil
+	})
+	AcquisTomb.Go(func() error {
+		<-AcquisTomb.Dying()
+		log.Infof("Killing http acquisition %s", h.Name())
+		//the pending batches are aborted by the dying tomb, so this shouldn't take long
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.server.Shutdown(ctx); err != nil {
+			log.Warningf("while shutting down http acquisition : %s", err)
+		}
+		return nil
+	})
+	return nil
+}
+
+//httpReply sends a json body, along with the number of records that were accepted
+func httpReply(w http.ResponseWriter, status int, accepted int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	body := map[string]interface{}{"accepted": accepted}
+	if message != "" {
+		body["message"] = message
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *HTTPSource) handleBatch(w http.ResponseWriter, r *http.Request, output chan types.Event, AcquisTomb *tomb.Tomb) {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	clog := log.WithFields(log.Fields{"http client": remote})
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpReply(w, http.StatusMethodNotAllowed, 0, "only POST is allowed")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(h.config.SecretHeader)), []byte(h.config.Secret)) != 1 {
+		clog.Warningf("invalid or missing %s header", h.config.SecretHeader)
+		HTTPRejected.With(prometheus.Labels{"reason": "unauthorized"}).Inc()
+		httpReply(w, http.StatusUnauthorized, 0, "invalid secret")
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, h.config.MaxBodySize))
+	if err != nil {
+		HTTPRejected.With(prometheus.Labels{"reason": "invalid"}).Inc()
+		httpReply(w, http.StatusRequestEntityTooLarge, 0, fmt.Sprintf("while reading body : %s", err))
+		return
+	}
+	//the whole batch is checked before anything is sent, so that a 400 means nothing was accepted
+	evts, err := h.batchToEvents(body, r.Header.Get("Content-Type"), remote)
+	if err != nil {
+		clog.Warningf("invalid batch : %s", err)
+		HTTPRejected.With(prometheus.Labels{"reason": "invalid"}).Inc()
+		httpReply(w, http.StatusBadRequest, 0, err.Error())
+		return
+	}
+	timeout := time.NewTimer(h.config.QueueTimeout)
+	defer timeout.Stop()
+	for idx, evt := range evts {
+		select {
+		case output <- evt:
+			//per source, as the client addresses are unbounded
+			ReaderHits.With(prometheus.Labels{"source": h.Name()}).Inc()
+		case <-timeout.C:
+			//back-pressure : the parsers are busy, let the client retry the remaining records later
+			clog.Warningf("parsers are busy, %d/%d records accepted", idx, len(evts))
+			HTTPRejected.With(prometheus.Labels{"reason": "busy"}).Inc()
+			w.Header().Set("Retry-After", "1")
+			httpReply(w, http.StatusServiceUnavailable, idx, "parsers are busy, retry the records that weren't accepted")
+			return
+		case <-AcquisTomb.Dying():
+			HTTPRejected.With(prometheus.Labels{"reason": "shutdown"}).Inc()
+			httpReply(w, http.StatusServiceUnavailable, idx, "shutting down")
+			return
+		}
+	}
+	httpReply(w, http.StatusOK, len(evts), "")
+}
+
+/*batchToEvents turns each line of the body into an event, json records are flattened into evt.Parsed*/
+func (h *HTTPSource) batchToEvents(body []byte, contentType string, remote string) ([]types.Event, error) {
+	isJSON := false
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		isJSON = mediaType == "application/x-ndjson" || mediaType == "application/json"
+	}
+	evts := []types.Event{}
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), int(h.config.MaxBodySize))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		raw := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		l := types.Line{}
+		l.Raw = raw
+		l.Labels = h.config.Labels
+		l.Time = time.Now()
+		l.Src = remote
+		l.Process = true
+		evt := types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.LIVE}
+		if isJSON {
+			record := map[string]interface{}{}
+			decoder := json.NewDecoder(strings.NewReader(raw))
+			decoder.UseNumber()
+			if err := decoder.Decode(&record); err != nil {
+				return nil, fmt.Errorf("line %d : invalid json record : %s", lineNum, err)
+			}
+			evt.Parsed = make(map[string]string)
+			flattenRecord("", record, evt.Parsed)
+		}
+		evts = append(evts, evt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d : %s", lineNum+1, err)
+	}
+	return evts, nil
+}
+
+/*flattenRecord turns nested objects into dotted keys, and arrays into their json representation*/
+func flattenRecord(prefix string, record map[string]interface{}, parsed map[string]string) {
+	for k, v := range record {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case nil:
+			continue
+		case string:
+			parsed[key] = value
+		case map[string]interface{}:
+			flattenRecord(key, value, parsed)
+		case []interface{}:
+			if buf, err := json.Marshal(value); err == nil {
+				parsed[key] = string(buf)
+			}
+		default:
+			parsed[key] = fmt.Sprintf("%v", value)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package acquisition
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func postBatch(t *testing.T, url string, secret string, contentType string, body string) (int, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if secret != "" {
+		req.Header.Set("X-Crowdsec-Secret", secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ret := map[string]interface{}{}
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		t.Fatalf("invalid response : %s", err)
+	}
+	return resp.StatusCode, ret
+}
+
+func startHTTPSource(t *testing.T, cfg string) (chan types.Event, *tomb.Tomb) {
+	source, err := DataSourceFromConfig([]byte(cfg))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := &tomb.Tomb{}
+	if err := source.StartReading(output, acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	return output, acquisTomb
+}
+
+func TestHTTPConfigure(t *testing.T) {
+	_, err := DataSourceFromConfig([]byte("type: http\nlabels:\n  type: myapp\n"))
+	assert.EqualError(t, err, "while configuring http acquisition : secret is mandatory")
+	_, err = DataSourceFromConfig([]byte("type: http\nsecret: s3cr3t\ncert_file: cert.pem\nlabels:\n  type: myapp\n"))
+	assert.EqualError(t, err, "while configuring http acquisition : cert_file and key_file must be set together")
+	_, err = DataSourceFromConfig([]byte("type: http\nmode: cat\nsecret: s3cr3t\nlabels:\n  type: myapp\n"))
+	assert.EqualError(t, err, "while configuring http acquisition : http acquisition only supports tail mode")
+}
+
+func TestHTTPBatch(t *testing.T) {
+	output, acquisTomb := startHTTPSource(t, "type: http\nlisten_port: 45143\npath: /events\nsecret: s3cr3t\nlabels:\n  type: myapp\n")
+	url := "http://127.0.0.1:45143/events"
+
+	status, _ := postBatch(t, url, "", "text/plain", "hello\n")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = postBatch(t, url, "wrong", "text/plain", "hello\n")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	//nothing is sent if a record is invalid
+	status, ret := postBatch(t, url, "s3cr3t", "application/x-ndjson", "{\"event\":\"failed_login\"}\nnot json\n")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "line 2 : invalid json record : invalid character 'o' in literal null (expecting 'u')", ret["message"])
+
+	type result struct {
+		status int
+		ret    map[string]interface{}
+	}
+	done := make(chan result)
+	go func() {
+		status, ret := postBatch(t, url, "s3cr3t", "application/x-ndjson; charset=utf-8", "{\"event\":\"failed_login\",\"source_ip\":\"1.2.3.4\",\"user\":{\"name\":\"bob\",\"id\":42},\"roles\":[\"admin\"]}\n\n{\"event\":\"invalid_token\"}\n")
+		done <- result{status, ret}
+	}()
+	evts := readEvents(output, 2)
+	res := <-done
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, float64(2), res.ret["accepted"])
+	if len(evts) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(evts))
+	}
+	assert.Equal(t, map[string]string{"event": "failed_login", "source_ip": "1.2.3.4", "user.name": "bob", "user.id": "42", "roles": `["admin"]`}, evts[0].Parsed)
+	assert.Equal(t, "127.0.0.1", evts[0].Line.Src)
+	assert.Equal(t, "myapp", evts[0].Line.Labels["type"])
+	assert.Equal(t, `{"event":"invalid_token"}`, evts[1].Line.Raw)
+	//hits are counted by source, not by client
+	assert.Equal(t, float64(2), testutil.ToFloat64(ReaderHits.With(prometheus.Labels{"source": "http:127.0.0.1:45143/events"})))
+
+	go func() {
+		status, ret := postBatch(t, url, "s3cr3t", "text/plain", "plain line\r\n")
+		done <- result{status, ret}
+	}()
+	evts = readEvents(output, 1)
+	res = <-done
+	assert.Equal(t, http.StatusOK, res.status)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "plain line", evts[0].Line.Raw)
+	assert.Nil(t, evts[0].Parsed)
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestHTTPBackPressure(t *testing.T) {
+	output, acquisTomb := startHTTPSource(t, "type: http\nlisten_port: 45144\nsecret: s3cr3t\nqueue_timeout: 200ms\nlabels:\n  type: myapp\n")
+	url := "http://127.0.0.1:45144/"
+
+	//only the first record is read
+	go func() {
+		<-output
+	}()
+	status, ret := postBatch(t, url, "s3cr3t", "text/plain", "one\ntwo\nthree\n")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, float64(1), ret["accepted"])
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	//not listening anymore
+	client := http.Client{Timeout: time.Second}
+	_, err := client.Get(url)
+	assert.Error(t, err)
+}
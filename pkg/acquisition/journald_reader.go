@@ -0,0 +1,278 @@
+package acquisition
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const JOURNALDTYPE = "journald"
+
+//journalctlCmd can be overridden by tests
+var journalctlCmd = "journalctl"
+
+type JournaldConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	Filters             []string `yaml:"journalctl_filter,omitempty"` //FIELD=value matches, as given to journalctl
+	Filename            string   `yaml:"filename,omitempty"`          //the output of `journalctl -o json`, read in cat mode
+}
+
+/*
+ JournaldSource reads the json export of the journal, either by running `journalctl -o json`, or from a file.
+ Entries are turned into syslog lines, so that the syslog parsers can process them.
+*/
+type JournaldSource struct {
+	config  JournaldConfiguration
+	matches map[string][]string //the filters, by field, used when reading from a file
+}
+
+func init() {
+	RegisterDataSource(JOURNALDTYPE, func() DataSource { return &JournaldSource{} })
+}
+
+func (j *JournaldSource) Configure(cfg []byte) error {
+	journaldConfig := JournaldConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &journaldConfig); err != nil {
+		return fmt.Errorf("while parsing journald acquisition : %s", err)
+	}
+	if journaldConfig.Mode == "" {
+		journaldConfig.Mode = TAILMODE
+		if journaldConfig.Filename != "" {
+			journaldConfig.Mode = CATMODE
+		}
+	}
+	if journaldConfig.Mode != TAILMODE && journaldConfig.Mode != CATMODE {
+		return fmt.Errorf("unknown read mode %s for journald", journaldConfig.Mode)
+	}
+	if journaldConfig.Filename != "" && journaldConfig.Mode != CATMODE {
+		return fmt.Errorf("filename is only supported in %s mode", CATMODE)
+	}
+	j.matches = make(map[string][]string)
+	for _, filter := range journaldConfig.Filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid journalctl_filter '%s', expected FIELD=value", filter)
+		}
+		j.matches[kv[0]] = append(j.matches[kv[0]], kv[1])
+	}
+	j.config = journaldConfig
+	return nil
+}
+
+func (j *JournaldSource) Mode() string {
+	return j.config.Mode
+}
+
+func (j *JournaldSource) Name() string {
+	if j.config.Filename != "" {
+		return "journald:" + j.config.Filename
+	}
+	return "journald:" + strings.Join(j.config.Filters, " ")
+}
+
+//journalctlArgs returns the arguments of journalctl, filters are passed as-is
+func (j *JournaldSource) journalctlArgs() []string {
+	args := []string{"-o", "json", "--no-pager"}
+	if j.config.Mode == TAILMODE {
+		//only the new entries
+		args = append(args, "-f", "-n", "0")
+	}
+	return append(args, j.config.Filters...)
+}
+
+func (j *JournaldSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	if j.config.Filename != "" {
+		fd, err := os.Open(j.config.Filename)
+		if err != nil {
+			return fmt.Errorf("while opening %s : %s", j.config.Filename, err)
+		}
+		AcquisTomb.Go(func() error {
+			defer fd.Close()
+			//journalctl applies the filters itself, not the file
+			return j.readEntries(fd, true, output, AcquisTomb)
+		})
+		return nil
+	}
+	cmd := exec.Command(journalctlCmd, j.journalctlArgs()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("while getting journalctl output : %s", err)
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("while starting journalctl : %s", err)
+	}
+	log.Infof("started %s %s", journalctlCmd, strings.Join(j.journalctlArgs(), " "))
+	AcquisTomb.Go(func() error {
+		<-AcquisTomb.Dying()
+		//if it's already done, the error doesn't matter
+		cmd.Process.Kill()
+		return nil
+	})
+	AcquisTomb.Go(func() error {
+		err := j.readEntries(stdout, false, output, AcquisTomb)
+		if waitErr := cmd.Wait(); waitErr != nil && err == nil {
+			select {
+			case <-AcquisTomb.Dying():
+			default:
+				err = fmt.Errorf("journalctl exited : %s", waitErr)
+			}
+		}
+		return err
+	})
+	return nil
+}
+
+func (j *JournaldSource) readEntries(reader io.Reader, filter bool, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	clog := log.WithFields(log.Fields{
+		"journald": j.Name(),
+	})
+	expectMode := leaky.LIVE
+	if j.config.Mode == CATMODE {
+		expectMode = leaky.TIMEMACHINE
+	}
+	count := 0
+	scanner := bufio.NewScanner(reader)
+	//journal entries can be big
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			clog.Warningf("invalid journal entry : %s", err)
+			continue
+		}
+		if filter && !j.matchEntry(entry) {
+			continue
+		}
+		evt, ok := j.entryToEvent(entry, expectMode)
+		if !ok {
+			continue
+		}
+		count++
+		ReaderHits.With(prometheus.Labels{"source": evt.Line.Src}).Inc()
+		select {
+		case output <- evt:
+		case <-AcquisTomb.Dying():
+			clog.Infof("acquisition is dying, stop reading after %d entries", count)
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		select {
+		case <-AcquisTomb.Dying():
+			return nil
+		default:
+			return fmt.Errorf("while reading journal : %s", err)
+		}
+	}
+	clog.Infof("read %d entries", count)
+	return nil
+}
+
+/*matchEntry mimics journalctl : matches on the same field are OR'ed, matches on different fields are AND'ed*/
+func (j *JournaldSource) matchEntry(entry map[string]interface{}) bool {
+	for field, values := range j.matches {
+		value, ok := journalField(entry, field)
+		if !ok {
+			return false
+		}
+		found := false
+		for _, expected := range values {
+			if value == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/*journalField returns a field as a string : fields are strings, arrays of bytes when they aren't printable, or arrays of values when they're repeated*/
+func journalField(entry map[string]interface{}, field string) (string, bool) {
+	raw, ok := entry[field]
+	if !ok || raw == nil {
+		return "", false
+	}
+	switch value := raw.(type) {
+	case string:
+		return value, true
+	case []interface{}:
+		if len(value) == 0 {
+			return "", false
+		}
+		if _, isNumber := value[0].(float64); isNumber {
+			buf := make([]byte, 0, len(value))
+			for _, b := range value {
+				n, ok := b.(float64)
+				if !ok {
+					return "", false
+				}
+				buf = append(buf, byte(n))
+			}
+			return string(buf), true
+		}
+		//repeated field, keep the first value
+		if s, ok := value[0].(string); ok {
+			return s, true
+		}
+	}
+	return fmt.Sprintf("%v", raw), true
+}
+
+func (j *JournaldSource) entryToEvent(entry map[string]interface{}, expectMode int) (types.Event, bool) {
+	message, ok := journalField(entry, "MESSAGE")
+	if !ok {
+		return types.Event{}, false
+	}
+	ts := time.Now()
+	if usec, ok := journalField(entry, "__REALTIME_TIMESTAMP"); ok {
+		if n, err := strconv.ParseInt(usec, 10, 64); err == nil {
+			ts = time.Unix(0, n*int64(time.Microsecond))
+		}
+	}
+	hostname, _ := journalField(entry, "_HOSTNAME")
+	identifier, _ := journalField(entry, "SYSLOG_IDENTIFIER")
+	pid, ok := journalField(entry, "SYSLOG_PID")
+	if !ok {
+		pid, _ = journalField(entry, "_PID")
+	}
+	unit, _ := journalField(entry, "_SYSTEMD_UNIT")
+
+	l := types.Line{}
+	l.Raw = FormatSyslogLine(ts, hostname, identifier, pid, message)
+	l.Time = ts
+	l.Src = "journald"
+	if unit != "" {
+		l.Src = unit
+	}
+	l.Labels = j.config.Labels
+	l.Process = true
+	evt := types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: expectMode}
+	//the syslog parsers will override them, but they are available to the other parsers
+	evt.Parsed = map[string]string{
+		"systemd_unit": unit,
+		"program":      identifier,
+		"message":      message,
+	}
+	return evt, true
+}
@@ -0,0 +1,105 @@
+package acquisition
+
+import (
+	"testing"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func TestJournaldConfigure(t *testing.T) {
+	tests := []struct {
+		config string
+		args   []string
+		err    string
+	}{
+		{
+			config: "type: journald\njournalctl_filter:\n - _SYSTEMD_UNIT=ssh.service\nlabels:\n  type: syslog\n",
+			args:   []string{"-o", "json", "--no-pager", "-f", "-n", "0", "_SYSTEMD_UNIT=ssh.service"},
+		},
+		{
+			config: "type: journald\nmode: cat\nlabels:\n  type: syslog\n",
+			args:   []string{"-o", "json", "--no-pager"},
+		},
+		{
+			config: "type: journald\njournalctl_filter:\n - ssh.service\nlabels:\n  type: syslog\n",
+			err:    "while configuring journald acquisition : invalid journalctl_filter 'ssh.service', expected FIELD=value",
+		},
+		{
+			config: "type: journald\nmode: tail\nfilename: ./tests/journal.json\nlabels:\n  type: syslog\n",
+			err:    "while configuring journald acquisition : filename is only supported in cat mode",
+		},
+	}
+	for _, test := range tests {
+		source, err := DataSourceFromConfig([]byte(test.config))
+		if test.err != "" {
+			assert.EqualError(t, err, test.err)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error : %s", err)
+		}
+		assert.Equal(t, test.args, source.(*JournaldSource).journalctlArgs())
+	}
+}
+
+func TestJournaldFile(t *testing.T) {
+	source, err := DataSourceFromConfig([]byte("type: journald\nfilename: ./tests/journal.json\njournalctl_filter:\n - _SYSTEMD_UNIT=ssh.service\nlabels:\n  type: syslog\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	evts := readEvents(output, 3)
+	//the systemd entry is filtered out, the last one has no message
+	if len(evts) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(evts))
+	}
+	ts := time.Unix(1596276000, 0)
+	assert.Equal(t, ts.Local().Format(time.Stamp)+" myhost sshd[4242]: Invalid user toto from 1.2.3.4 port 4242", evts[0].Line.Raw)
+	assert.Equal(t, ts, evts[0].Line.Time)
+	assert.Equal(t, "ssh.service", evts[0].Line.Src)
+	assert.Equal(t, "syslog", evts[0].Line.Labels["type"])
+	assert.Equal(t, leaky.TIMEMACHINE, evts[0].ExpectMode)
+	assert.Equal(t, map[string]string{"systemd_unit": "ssh.service", "program": "sshd", "message": "Invalid user toto from 1.2.3.4 port 4242"}, evts[0].Parsed)
+	//non-printable messages are exported as arrays of bytes
+	assert.Equal(t, "Failed password\x1b", evts[1].Parsed["message"])
+
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestJournaldCommand(t *testing.T) {
+	journalctlCmd = "./tests/journalctl.sh"
+	defer func() { journalctlCmd = "journalctl" }()
+
+	source, err := DataSourceFromConfig([]byte("type: journald\nlabels:\n  type: syslog\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	//journalctl does the filtering itself
+	evts := readEvents(output, 4)
+	if len(evts) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(evts))
+	}
+	assert.Equal(t, leaky.LIVE, evts[0].ExpectMode)
+	assert.Equal(t, "journald", evts[1].Line.Src)
+
+	//journalctl is still running, it must be killed
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
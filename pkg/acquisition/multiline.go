@@ -0,0 +1,110 @@
+package acquisition
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+ MultilineConfig allows to join several physical lines (ie. a java stack trace) into a single event :
+  - a line matching start_pattern starts a new event
+  - a line matching continuation_pattern is appended to the current event
+ If only one of the patterns is set, lines not matching it are respectively appended to the current event, or start a new one.
+ If both are set, a line matching none of them is an event on its own.
+*/
+type MultilineConfig struct {
+	StartPattern        string        `yaml:"start_pattern,omitempty"`
+	ContinuationPattern string        `yaml:"continuation_pattern,omitempty"`
+	MaxLines            int           `yaml:"max_lines,omitempty"`     //the event is flushed when it reaches max_lines
+	FlushTimeout        time.Duration `yaml:"flush_timeout,omitempty"` //in tail mode, the event is flushed when no line came for flush_timeout
+	start               *regexp.Regexp
+	continuation        *regexp.Regexp
+}
+
+func (m *MultilineConfig) compile() error {
+	var err error
+
+	if m.StartPattern == "" && m.ContinuationPattern == "" {
+		return fmt.Errorf("multiline requires start_pattern and/or continuation_pattern")
+	}
+	if m.StartPattern != "" {
+		if m.start, err = regexp.Compile(m.StartPattern); err != nil {
+			return fmt.Errorf("invalid start_pattern '%s' : %s", m.StartPattern, err)
+		}
+	}
+	if m.ContinuationPattern != "" {
+		if m.continuation, err = regexp.Compile(m.ContinuationPattern); err != nil {
+			return fmt.Errorf("invalid continuation_pattern '%s' : %s", m.ContinuationPattern, err)
+		}
+	}
+	if m.MaxLines < 0 {
+		return fmt.Errorf("max_lines can't be negative")
+	}
+	if m.MaxLines == 0 {
+		m.MaxLines = 500
+	}
+	if m.FlushTimeout == 0 {
+		m.FlushTimeout = time.Second
+	}
+	//the pending event is checked every flush_timeout/2
+	if m.FlushTimeout < time.Millisecond {
+		return fmt.Errorf("flush_timeout must be at least 1ms (got %s)", m.FlushTimeout)
+	}
+	return nil
+}
+
+//Multiline holds the lines of the event being assembled, there is one per file
+type Multiline struct {
+	config *MultilineConfig
+	lines  []string
+	time   time.Time //the time of the first line
+}
+
+func NewMultiline(config *MultilineConfig) *Multiline {
+	return &Multiline{config: config}
+}
+
+func (m *Multiline) startsEvent(line string) bool {
+	if m.config.start != nil {
+		if m.config.start.MatchString(line) {
+			return true
+		}
+		return m.config.continuation != nil && !m.config.continuation.MatchString(line)
+	}
+	return !m.config.continuation.MatchString(line)
+}
+
+//Add feeds a line, and returns the event it completed if any
+func (m *Multiline) Add(line string, ts time.Time) (string, time.Time, bool) {
+	if len(m.lines) > 0 && m.startsEvent(line) {
+		event, evtTime, _ := m.Flush()
+		m.lines = append(m.lines, line)
+		m.time = ts
+		return event, evtTime, true
+	}
+	if len(m.lines) == 0 {
+		m.time = ts
+	}
+	m.lines = append(m.lines, line)
+	if len(m.lines) >= m.config.MaxLines {
+		return m.Flush()
+	}
+	return "", time.Time{}, false
+}
+
+//Flush returns the pending event, if any
+func (m *Multiline) Flush() (string, time.Time, bool) {
+	if len(m.lines) == 0 {
+		return "", time.Time{}, false
+	}
+	event := strings.Join(m.lines, "\n")
+	m.lines = nil
+	return event, m.time, true
+}
+
+//Len is the number of lines of the pending event
+func (m *Multiline) Len() int {
+	return len(m.lines)
+}
@@ -0,0 +1,160 @@
+package acquisition
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		config   MultilineConfig
+		lines    []string
+		expected []string
+		err      string
+	}{
+		{
+			config:   MultilineConfig{StartPattern: `^\d{4}-`},
+			lines:    []string{"2020-01-01 a", " b", " c", "2020-01-01 d", "2020-01-01 e", " f"},
+			expected: []string{"2020-01-01 a\n b\n c", "2020-01-01 d", "2020-01-01 e\n f"},
+		},
+		{
+			config:   MultilineConfig{ContinuationPattern: `^\s`},
+			lines:    []string{"a", " b", "c", " d", " e"},
+			expected: []string{"a\n b", "c\n d\n e"},
+		},
+		{
+			//lines that neither start nor continue an event are on their own
+			config:   MultilineConfig{StartPattern: `^START`, ContinuationPattern: `^\s`},
+			lines:    []string{"START a", " b", "other", " c", "START d"},
+			expected: []string{"START a\n b", "other\n c", "START d"},
+		},
+		{
+			config:   MultilineConfig{ContinuationPattern: `^\s`, MaxLines: 2},
+			lines:    []string{"a", " b", " c", " d", " e"},
+			expected: []string{"a\n b", " c\n d", " e"},
+		},
+		{
+			config: MultilineConfig{},
+			err:    "multiline requires start_pattern and/or continuation_pattern",
+		},
+		{
+			config: MultilineConfig{StartPattern: `^(`},
+			err:    "invalid start_pattern '^(' : error parsing regexp: missing closing ): `^(`",
+		},
+		{
+			config: MultilineConfig{StartPattern: `^START`, FlushTimeout: -time.Second},
+			err:    "flush_timeout must be at least 1ms (got -1s)",
+		},
+		{
+			config: MultilineConfig{StartPattern: `^START`, FlushTimeout: time.Nanosecond},
+			err:    "flush_timeout must be at least 1ms (got 1ns)",
+		},
+	}
+
+	for idx, test := range tests {
+		config := test.config
+		err := config.compile()
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, "test %d", idx)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d : unexpected error : %s", idx, err)
+		}
+		ml := NewMultiline(&config)
+		events := []string{}
+		for _, line := range test.lines {
+			if raw, _, ok := ml.Add(line, time.Now()); ok {
+				events = append(events, raw)
+			}
+		}
+		if raw, _, ok := ml.Flush(); ok {
+			events = append(events, raw)
+		}
+		assert.Equal(t, test.expected, events, "test %d", idx)
+	}
+}
+
+func TestMultilineCat(t *testing.T) {
+	source, err := DataSourceFromConfig([]byte(`filename: ./tests/multiline.log
+mode: cat
+multiline:
+  start_pattern: '^\d{4}-\d{2}-\d{2} '
+labels:
+  type: java
+`))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	evts := readEvents(output, 4)
+	if len(evts) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(evts))
+	}
+	assert.Equal(t, 4, len(strings.Split(evts[0].Line.Raw, "\n")))
+	assert.Equal(t, "2020-08-01 10:00:01 INFO all good", evts[1].Line.Raw)
+	assert.Equal(t, "2020-08-01 10:00:02 ERROR again\n\tat com.example.Foo.bar(Foo.java:42)", evts[2].Line.Raw)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestMultilineTailFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multiline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(logFile, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := DataSourceFromConfig([]byte(`filename: ` + logFile + `
+multiline:
+  continuation_pattern: '^\s'
+  flush_timeout: 200ms
+labels:
+  type: java
+`))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("exception\n\tat foo\n\tat bar\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	//no line starts a new event : the last one is flushed after flush_timeout
+	evts := readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "exception\n\tat foo\n\tat bar", evts[0].Line.Raw)
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
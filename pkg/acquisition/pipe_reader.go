@@ -0,0 +1,192 @@
+package acquisition
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	PIPETYPE = "pipe"
+	//STDIN is the filename standing for the standard input
+	STDIN = "-"
+)
+
+type PipeConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	Filename            string `yaml:"filename,omitempty"` //a named pipe, or - for stdin
+}
+
+/*
+ PipeSource reads lines from stdin or a named pipe.
+ In cat mode, it stops at EOF, so that a one-shot run can complete.
+ In tail mode, a named pipe is re-opened at EOF to wait for the next writer (stdin can't be tailed).
+*/
+type PipeSource struct {
+	config PipeConfiguration
+}
+
+func init() {
+	RegisterDataSource(PIPETYPE, func() DataSource { return &PipeSource{} })
+}
+
+func (p *PipeSource) Configure(cfg []byte) error {
+	pipeConfig := PipeConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &pipeConfig); err != nil {
+		return fmt.Errorf("while parsing pipe acquisition : %s", err)
+	}
+	if pipeConfig.Mode == "" {
+		pipeConfig.Mode = CATMODE
+	}
+	if pipeConfig.Mode != TAILMODE && pipeConfig.Mode != CATMODE {
+		return fmt.Errorf("unknown read mode %s for %s", pipeConfig.Mode, pipeConfig.Filename)
+	}
+	if pipeConfig.Filename == "" {
+		pipeConfig.Filename = STDIN
+	}
+	//there is nothing to wait for once stdin is closed
+	if pipeConfig.Filename == STDIN && pipeConfig.Mode == TAILMODE {
+		return fmt.Errorf("stdin can't be read in %s mode, use %s mode or a named pipe", TAILMODE, CATMODE)
+	}
+	if pipeConfig.Filename != STDIN {
+		fi, err := os.Stat(pipeConfig.Filename)
+		if err != nil {
+			return fmt.Errorf("unable to access %s : %s", pipeConfig.Filename, err)
+		}
+		if fi.IsDir() {
+			return fmt.Errorf("%s is a directory", pipeConfig.Filename)
+		}
+		//a regular file would be read again and again
+		if pipeConfig.Mode == TAILMODE && fi.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s isn't a named pipe, use the file type to tail it", pipeConfig.Filename)
+		}
+	}
+	p.config = pipeConfig
+	return nil
+}
+
+func (p *PipeSource) Mode() string {
+	return p.config.Mode
+}
+
+func (p *PipeSource) Name() string {
+	if p.config.Filename == STDIN {
+		return "pipe:stdin"
+	}
+	return "pipe:" + p.config.Filename
+}
+
+func (p *PipeSource) source() string {
+	if p.config.Filename == STDIN {
+		return "stdin"
+	}
+	return p.config.Filename
+}
+
+func (p *PipeSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	/*
+	 reads on stdin or a pipe can't be interrupted, and opening a named pipe blocks until there is a writer :
+	 this is done outside of the tomb, so that acquisition can be stopped anyway.
+	*/
+	go p.readLines(lines, readErr, AcquisTomb)
+	AcquisTomb.Go(func() error {
+		return p.forwardLines(lines, readErr, output, AcquisTomb)
+	})
+	return nil
+}
+
+func (p *PipeSource) open() (io.ReadCloser, error) {
+	if p.config.Filename == STDIN {
+		//don't close stdin
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(p.config.Filename)
+}
+
+//readLines sends the lines to the chan, and closes it once there is nothing more to read
+func (p *PipeSource) readLines(lines chan string, readErr chan error, AcquisTomb *tomb.Tomb) {
+	for {
+		fd, err := p.open()
+		if err != nil {
+			readErr <- fmt.Errorf("while opening %s : %s", p.source(), err)
+			return
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-AcquisTomb.Dying():
+				fd.Close()
+				return
+			}
+		}
+		fd.Close()
+		if err := scanner.Err(); err != nil {
+			readErr <- fmt.Errorf("while reading %s : %s", p.source(), err)
+			return
+		}
+		//a named pipe is closed when the writer goes away, wait for the next one
+		if p.config.Mode == TAILMODE && p.config.Filename != STDIN {
+			log.Debugf("EOF on %s, waiting for a new writer", p.source())
+			continue
+		}
+		close(lines)
+		return
+	}
+}
+
+func (p *PipeSource) forwardLines(lines chan string, readErr chan error, output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	clog := log.WithFields(log.Fields{
+		"pipe": p.source(),
+	})
+	expectMode := leaky.TIMEMACHINE
+	if p.config.Mode == TAILMODE {
+		expectMode = leaky.LIVE
+	}
+	count := 0
+	for {
+		select {
+		case <-AcquisTomb.Dying():
+			clog.Infof("acquisition is dying, stop reading after %d lines", count)
+			return nil
+		case err := <-readErr:
+			clog.Errorf("%s", err)
+			return err
+		case line, ok := <-lines:
+			if !ok {
+				clog.Infof("EOF reached after %d lines", count)
+				return nil
+			}
+			if line == "" {
+				continue
+			}
+			count++
+			ReaderHits.With(prometheus.Labels{"source": p.source()}).Inc()
+			l := types.Line{}
+			l.Raw = line
+			l.Time = time.Now()
+			l.Src = p.source()
+			l.Labels = p.config.Labels
+			l.Process = true
+			select {
+			case output <- types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: expectMode}:
+			case <-AcquisTomb.Dying():
+				clog.Infof("acquisition is dying, stop reading after %d lines", count)
+				return nil
+			}
+		}
+	}
+}
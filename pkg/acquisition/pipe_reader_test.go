@@ -0,0 +1,126 @@
+package acquisition
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+	"gopkg.in/tomb.v2"
+)
+
+func TestPipeStdin(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldStdin := os.Stdin
+	os.Stdin = reader
+	defer func() { os.Stdin = oldStdin }()
+
+	source, err := DataSourceFromConfig([]byte("type: pipe\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	assert.Equal(t, "pipe:stdin", source.Name())
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	if _, err := writer.WriteString("line1\n\nline2\n"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	evts := readEvents(output, 3)
+	assert.Equal(t, 2, len(evts))
+	for _, evt := range evts {
+		assert.Equal(t, leaky.TIMEMACHINE, evt.ExpectMode)
+		assert.Equal(t, "stdin", evt.Line.Src)
+	}
+	//EOF ends the acquisition
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestPipeFifoTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fifo := filepath.Join(dir, "fifo")
+	if err := unix.Mkfifo(fifo, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := DataSourceFromConfig([]byte("type: pipe\nmode: tail\nfilename: " + fifo + "\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	//in tail mode, the pipe is re-opened when a writer goes away
+	for _, line := range []string{"first writer\n", "second writer\n"} {
+		writer, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+		evts := readEvents(output, 1)
+		assert.Equal(t, 1, len(evts))
+		if len(evts) == 1 {
+			assert.Equal(t, line[:len(line)-1], evts[0].Line.Raw)
+			assert.Equal(t, leaky.LIVE, evts[0].ExpectMode)
+			assert.Equal(t, fifo, evts[0].Line.Src)
+		}
+	}
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestPipeConfigure(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{
+			config: "type: pipe\nmode: foobar\nlabels:\n  type: test\n",
+			err:    "while configuring pipe acquisition : unknown read mode foobar for ",
+		},
+		{
+			config: "type: pipe\nfilename: /does/not/exist\nlabels:\n  type: test\n",
+			err:    "while configuring pipe acquisition : unable to access /does/not/exist : stat /does/not/exist: no such file or directory",
+		},
+		{
+			config: "type: pipe\nfilename: ./tests/\nlabels:\n  type: test\n",
+			err:    "while configuring pipe acquisition : ./tests/ is a directory",
+		},
+		{
+			config: "type: pipe\nmode: tail\nlabels:\n  type: test\n",
+			err:    "while configuring pipe acquisition : stdin can't be read in tail mode, use cat mode or a named pipe",
+		},
+		{
+			config: "type: pipe\nmode: tail\nfilename: ./pipe_reader.go\nlabels:\n  type: test\n",
+			err:    "while configuring pipe acquisition : ./pipe_reader.go isn't a named pipe, use the file type to tail it",
+		},
+	}
+	for _, test := range tests {
+		_, err := DataSourceFromConfig([]byte(test.config))
+		assert.EqualError(t, err, test.err)
+	}
+}
@@ -0,0 +1,242 @@
+package acquisition
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/nxadm/tail"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+)
+
+/*
+ The position store keeps track of how far each tailed file has been read,
+ so that a restart (or a reload) resumes where we left off instead of
+ skipping everything that was written in between.
+*/
+
+//PositionsSaveInterval is how often the positions are flushed to disk while running
+var PositionsSaveInterval = 10 * time.Second
+
+//FilePosition is the last read offset of a file, the inode allows to detect rotation
+type FilePosition struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+type PositionStore struct {
+	path      string
+	positions map[string]FilePosition
+	lock      sync.Mutex
+}
+
+//NewPositionStore loads the positions from path, a missing file is not an error
+func NewPositionStore(path string) (*PositionStore, error) {
+	p := &PositionStore{path: path, positions: make(map[string]FilePosition)}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Infof("no positions file %s, starting from scratch", path)
+			return p, nil
+		}
+		return nil, fmt.Errorf("while reading positions file %s : %s", path, err)
+	}
+	if err := json.Unmarshal(body, &p.positions); err != nil {
+		//don't prevent crowdsec from starting for a corrupted positions file
+		log.Errorf("invalid positions file %s, ignoring it : %s", path, err)
+		p.positions = make(map[string]FilePosition)
+	}
+	return p, nil
+}
+
+func (p *PositionStore) Get(filename string) (FilePosition, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pos, ok := p.positions[filename]
+	return pos, ok
+}
+
+func (p *PositionStore) Set(filename string, pos FilePosition) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.positions[filename] = pos
+}
+
+//Save atomically writes the positions to disk
+func (p *PositionStore) Save() error {
+	p.lock.Lock()
+	body, err := json.Marshal(p.positions)
+	p.lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("while serializing positions : %s", err)
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(p.path), filepath.Base(p.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("while creating temp positions file : %s", err)
+	}
+	if _, err := tmpFile.Write(body); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("while writing %s : %s", tmpFile.Name(), err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("while writing %s : %s", tmpFile.Name(), err)
+	}
+	if err := os.Rename(tmpFile.Name(), p.path); err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("while renaming %s to %s : %s", tmpFile.Name(), p.path, err)
+	}
+	return nil
+}
+
+//SaveRoutine flushes the positions to disk every PositionsSaveInterval, until the tomb dies
+func (p *PositionStore) SaveRoutine(AcquisTomb *tomb.Tomb) error {
+	ticker := time.NewTicker(PositionsSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-AcquisTomb.Dying():
+			return nil
+		case <-ticker.C:
+			if err := p.Save(); err != nil {
+				log.Warningf("failed to save positions : %s", err)
+			}
+		}
+	}
+}
+
+/*
+ positionQueue holds back the positions of the tailed files of a buffered source : the position following
+ an event is only stored once the event left the buffer, so that the events that were still buffered
+ when crowdsec stopped are read again on restart.
+*/
+type positionQueue struct {
+	store   *PositionStore
+	pending map[string][]FilePosition //by file, the positions to store as its events leave the buffer, oldest first
+	lock    sync.Mutex
+}
+
+func newPositionQueue(store *PositionStore) *positionQueue {
+	return &positionQueue{store: store, pending: make(map[string][]FilePosition)}
+}
+
+//Sent queues the position following an event that is about to be sent to the buffer
+func (q *positionQueue) Sent(filename string, pos FilePosition) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.pending[filename] = append(q.pending[filename], pos)
+}
+
+//Set stores a position that isn't tied to an event, once the events before it left the buffer
+func (q *positionQueue) Set(filename string, pos FilePosition) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if queue := q.pending[filename]; len(queue) > 0 {
+		queue[len(queue)-1] = pos
+		return
+	}
+	q.store.Set(filename, pos)
+}
+
+//Released is called when the oldest event of a file left the buffer, either forwarded to the parsers or dropped
+func (q *positionQueue) Released(evt types.Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	queue := q.pending[evt.Line.Src]
+	if len(queue) == 0 {
+		return
+	}
+	q.store.Set(evt.Line.Src, queue[0])
+	if len(queue) == 1 {
+		delete(q.pending, evt.Line.Src)
+		return
+	}
+	q.pending[evt.Line.Src] = queue[1:]
+}
+
+//Discarded is called when the newest event of a file was dropped on arrival : its position goes to the event before it
+func (q *positionQueue) Discarded(evt types.Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	queue := q.pending[evt.Line.Src]
+	switch len(queue) {
+	case 0:
+		return
+	case 1:
+		q.store.Set(evt.Line.Src, queue[0])
+		delete(q.pending, evt.Line.Src)
+	default:
+		queue[len(queue)-2] = queue[len(queue)-1]
+		q.pending[evt.Line.Src] = queue[:len(queue)-1]
+	}
+}
+
+//fileID identifies a file whatever its name, ie. across renames
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func fileIdentity(filename string) (fileID, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return fileID{}, err
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, fmt.Errorf("unable to get inode of %s", filename)
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, nil
+}
+
+func fileInode(filename string) (uint64, int64, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("unable to get inode of %s", filename)
+	}
+	return uint64(stat.Ino), fi.Size(), nil
+}
+
+/*
+ StartPosition returns where the tail of filename should start :
+  - unknown file : from the end, as we used to
+  - same inode : from the saved offset, or from the start if the file was truncated
+  - other inode : the file was rotated while we were away, from the start
+*/
+func (p *PositionStore) StartPosition(filename string) *tail.SeekInfo {
+	clog := log.WithFields(log.Fields{"acquisition file": filename})
+	end := &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}
+	pos, ok := p.Get(filename)
+	if !ok {
+		return end
+	}
+	inode, size, err := fileInode(filename)
+	if err != nil {
+		clog.Warningf("can't stat file, starting from the end : %s", err)
+		return end
+	}
+	if inode != pos.Inode {
+		clog.Infof("file was rotated, reading from the start")
+		return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+	}
+	if pos.Offset > size {
+		clog.Infof("file was truncated (%d > %d), reading from the start", pos.Offset, size)
+		return &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}
+	}
+	clog.Infof("resuming at offset %d", pos.Offset)
+	return &tail.SeekInfo{Offset: pos.Offset, Whence: io.SeekStart}
+}
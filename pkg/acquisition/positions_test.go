@@ -0,0 +1,198 @@
+package acquisition
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/nxadm/tail"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func TestPositionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "positions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("line1\nline2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inode, _, err := fileInode(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positionsFile := filepath.Join(dir, "positions.json")
+	store, err := NewPositionStore(positionsFile)
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	//unknown file : from the end
+	assert.Equal(t, &tail.SeekInfo{Offset: 0, Whence: io.SeekEnd}, store.StartPosition(logFile))
+
+	store.Set(logFile, FilePosition{Inode: inode, Offset: 6})
+	if err := store.Save(); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	store, err = NewPositionStore(positionsFile)
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	//same file : resume
+	assert.Equal(t, &tail.SeekInfo{Offset: 6, Whence: io.SeekStart}, store.StartPosition(logFile))
+
+	//truncated file : from the start
+	store.Set(logFile, FilePosition{Inode: inode, Offset: 4242})
+	assert.Equal(t, &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}, store.StartPosition(logFile))
+
+	//rotated file : from the start
+	store.Set(logFile, FilePosition{Inode: inode + 1, Offset: 6})
+	assert.Equal(t, &tail.SeekInfo{Offset: 0, Whence: io.SeekStart}, store.StartPosition(logFile))
+
+	//corrupted file isn't fatal
+	if err := ioutil.WriteFile(positionsFile, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewPositionStore(positionsFile)
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	_, ok := store.Get(logFile)
+	assert.False(t, ok)
+}
+
+func TestTailResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "positions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("already read\nwritten while down\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inode, _, err := fileInode(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPositionStore(filepath.Join(dir, "positions.json"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	store.Set(logFile, FilePosition{Inode: inode, Offset: int64(len("already read\n"))})
+
+	source, err := DataSourceFromConfig([]byte("filename: " + logFile + "\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	source.(*FileSource).positions = store
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+
+	evts := readEvents(output, 2)
+	assert.Equal(t, 1, len(evts))
+	if len(evts) == 1 {
+		assert.Equal(t, "written while down", evts[0].Line.Raw)
+	}
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	pos, ok := store.Get(logFile)
+	assert.True(t, ok)
+	assert.Equal(t, FilePosition{Inode: inode, Offset: int64(len("already read\nwritten while down\n"))}, pos)
+}
+
+func TestPositionQueue(t *testing.T) {
+	store := &PositionStore{positions: make(map[string]FilePosition)}
+	queue := newPositionQueue(store)
+	evt := types.Event{Line: types.Line{Src: "test.log"}}
+	offset := func() int64 {
+		pos, _ := store.Get("test.log")
+		return pos.Offset
+	}
+
+	//nothing buffered : stored right away
+	queue.Set("test.log", FilePosition{Offset: 1})
+	assert.Equal(t, int64(1), offset())
+	//stored once the events leave the buffer
+	queue.Sent("test.log", FilePosition{Offset: 2})
+	queue.Sent("test.log", FilePosition{Offset: 3})
+	queue.Set("test.log", FilePosition{Offset: 4})
+	assert.Equal(t, int64(1), offset())
+	queue.Released(evt)
+	assert.Equal(t, int64(2), offset())
+	//the newest event is dropped : its position goes to the one before it
+	queue.Sent("test.log", FilePosition{Offset: 5})
+	queue.Discarded(evt)
+	assert.Equal(t, int64(2), offset())
+	queue.Released(evt)
+	assert.Equal(t, int64(5), offset())
+	queue.Released(evt)
+	assert.Equal(t, int64(5), offset())
+}
+
+func TestBufferedTailPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "positions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(timeout time.Duration) { BufferDrainTimeout = timeout }(BufferDrainTimeout)
+	BufferDrainTimeout = 100 * time.Millisecond
+
+	logFile := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(logFile, []byte("line 1\nline 2\nline 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inode, _, err := fileInode(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewPositionStore(filepath.Join(dir, "positions.json"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	store.Set(logFile, FilePosition{Inode: inode, Offset: 0})
+
+	source, err := DataSourceFromConfig([]byte("filename: " + logFile + "\nbuffer_size: 10\nlabels:\n  type: test\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	fileSource := unwrapSource(source).(*FileSource)
+	fileSource.positions = store
+	fileSource.pending = newPositionQueue(store)
+	source.(*bufferedSource).tracker = fileSource.pending
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+
+	//only the first line reaches the parsers, the other ones are still buffered on shutdown
+	evts := readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	time.Sleep(200 * time.Millisecond)
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	pos, ok := store.Get(logFile)
+	assert.True(t, ok)
+	assert.Equal(t, FilePosition{Inode: inode, Offset: int64(len("line 1\n"))}, pos)
+}
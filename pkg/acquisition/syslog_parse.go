@@ -0,0 +1,206 @@
+package acquisition
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ This file contains
+ - a minimalist parser for RFC3164 (BSD) and RFC5424 syslog messages
+ - the formatting of messages as 'local' syslog lines, as found in /var/log/syslog
+*/
+
+type SyslogMessage struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	Message   string
+}
+
+//ParseSyslogMessage parses a syslog message, guessing the RFC from the version field
+func ParseSyslogMessage(buf []byte) (*SyslogMessage, error) {
+	msg := &SyslogMessage{}
+
+	buf = bytes.TrimRight(buf, "\r\n\x00")
+	idx, err := parsePri(buf, msg)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[idx:]
+	//RFC5424 has a version number right after the PRI
+	if len(buf) > 1 && buf[0] >= '1' && buf[0] <= '9' && buf[1] == ' ' {
+		return msg, parseRFC5424(buf[2:], msg)
+	}
+	return msg, parseRFC3164(buf, msg)
+}
+
+func parsePri(buf []byte, msg *SyslogMessage) (int, error) {
+	if len(buf) == 0 || buf[0] != '<' {
+		return 0, fmt.Errorf("missing PRI")
+	}
+	end := bytes.IndexByte(buf, '>')
+	if end < 2 || end > 4 {
+		return 0, fmt.Errorf("invalid PRI")
+	}
+	pri, err := strconv.Atoi(string(buf[1:end]))
+	if err != nil || pri > 191 {
+		return 0, fmt.Errorf("invalid PRI '%s'", buf[1:end])
+	}
+	msg.Facility = pri / 8
+	msg.Severity = pri % 8
+	return end + 1, nil
+}
+
+//nextField returns the next space-separated token and the remaining buffer
+func nextField(buf []byte) (string, []byte) {
+	idx := bytes.IndexByte(buf, ' ')
+	if idx == -1 {
+		return string(buf), nil
+	}
+	return string(buf[:idx]), buf[idx+1:]
+}
+
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+func parseRFC5424(buf []byte, msg *SyslogMessage) error {
+	var field string
+	var err error
+
+	field, buf = nextField(buf)
+	if field != "-" {
+		msg.Timestamp, err = time.Parse(time.RFC3339Nano, field)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp '%s' : %s", field, err)
+		}
+	}
+	field, buf = nextField(buf)
+	msg.Hostname = nilValue(field)
+	field, buf = nextField(buf)
+	msg.AppName = nilValue(field)
+	field, buf = nextField(buf)
+	msg.ProcID = nilValue(field)
+	field, buf = nextField(buf)
+	msg.MsgID = nilValue(field)
+	if buf == nil {
+		return fmt.Errorf("truncated message")
+	}
+	//skip structured data, we don't use it
+	if len(buf) > 0 && buf[0] == '-' {
+		buf = buf[1:]
+	} else {
+		for len(buf) > 0 && buf[0] == '[' {
+			escaped := false
+			end := -1
+			for i := 1; i < len(buf); i++ {
+				if escaped {
+					escaped = false
+					continue
+				}
+				if buf[i] == '\\' {
+					escaped = true
+				} else if buf[i] == ']' {
+					end = i
+					break
+				}
+			}
+			if end == -1 {
+				return fmt.Errorf("unterminated structured data")
+			}
+			buf = buf[end+1:]
+		}
+	}
+	buf = bytes.TrimPrefix(buf, []byte(" "))
+	buf = bytes.TrimPrefix(buf, []byte("\xEF\xBB\xBF"))
+	msg.Message = string(buf)
+	return nil
+}
+
+func parseRFC3164(buf []byte, msg *SyslogMessage) error {
+	var err error
+	var field string
+
+	if len(buf) >= len(time.Stamp) {
+		msg.Timestamp, err = time.ParseInLocation(time.Stamp, string(buf[:len(time.Stamp)]), time.Local)
+		if err == nil {
+			//the year is missing, assume the current one
+			now := time.Now()
+			msg.Timestamp = msg.Timestamp.AddDate(now.Year(), 0, 0)
+			//december's logs received in january
+			if msg.Timestamp.After(now.AddDate(0, 1, 0)) {
+				msg.Timestamp = msg.Timestamp.AddDate(-1, 0, 0)
+			}
+			buf = bytes.TrimPrefix(buf[len(time.Stamp):], []byte(" "))
+		}
+	}
+	if msg.Timestamp.IsZero() {
+		//some implementations are sending RFC3339 timestamps
+		field, rest := nextField(buf)
+		if msg.Timestamp, err = time.Parse(time.RFC3339Nano, field); err == nil {
+			buf = rest
+		} else {
+			return fmt.Errorf("invalid timestamp")
+		}
+	}
+	//hostname is optional : if the first field looks like a tag, there is no hostname
+	field, rest := nextField(buf)
+	if !strings.HasSuffix(field, ":") && !strings.Contains(field, "[") && rest != nil {
+		msg.Hostname = field
+		buf = rest
+	}
+	//tag is everything up to ':' or '[', and is followed by the content
+	end := bytes.IndexAny(buf, ":[ ")
+	if end == -1 || buf[end] == ' ' {
+		//no tag
+		msg.Message = string(buf)
+		return nil
+	}
+	msg.AppName = string(buf[:end])
+	buf = buf[end:]
+	if buf[0] == '[' {
+		pidEnd := bytes.IndexByte(buf, ']')
+		if pidEnd == -1 {
+			return fmt.Errorf("unterminated pid")
+		}
+		msg.ProcID = string(buf[1:pidEnd])
+		buf = buf[pidEnd+1:]
+	}
+	buf = bytes.TrimPrefix(buf, []byte(":"))
+	buf = bytes.TrimPrefix(buf, []byte(" "))
+	msg.Message = string(buf)
+	return nil
+}
+
+//FormatSyslogLine formats a message like the ones found in /var/log/syslog, so that it can be handled by the usual syslog parsers
+func FormatSyslogLine(ts time.Time, hostname string, appname string, procid string, message string) string {
+	var sb strings.Builder
+
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	sb.WriteString(ts.Local().Format(time.Stamp))
+	sb.WriteString(" ")
+	sb.WriteString(hostname)
+	sb.WriteString(" ")
+	if appname != "" {
+		sb.WriteString(appname)
+		if procid != "" {
+			sb.WriteString("[" + procid + "]")
+		}
+		sb.WriteString(": ")
+	}
+	sb.WriteString(message)
+	return sb.String()
+}
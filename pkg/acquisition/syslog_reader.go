@@ -0,0 +1,296 @@
+package acquisition
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	leaky "github.com/crowdsecurity/crowdsec/pkg/leakybucket"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	tomb "gopkg.in/tomb.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const SYSLOGTYPE = "syslog"
+
+type SyslogConfiguration struct {
+	DataSourceCommonCfg `yaml:",inline"`
+	ListenAddr          string   `yaml:"listen_addr,omitempty"`
+	ListenPort          int      `yaml:"listen_port,omitempty"`
+	Protocols           []string `yaml:"protocols,omitempty"` //udp|tcp
+	MaxMessageLen       int      `yaml:"max_message_len,omitempty"`
+}
+
+/*SyslogSource is a syslog server : it listens for RFC3164/RFC5424 messages over UDP and/or TCP*/
+type SyslogSource struct {
+	config   SyslogConfiguration
+	udpConn  *net.UDPConn
+	listener net.Listener
+	conns    map[net.Conn]bool //the live tcp connections, closed at shutdown
+	connLock sync.Mutex
+}
+
+func init() {
+	RegisterDataSource(SYSLOGTYPE, func() DataSource { return &SyslogSource{} })
+}
+
+func (s *SyslogSource) Configure(cfg []byte) error {
+	syslogConfig := SyslogConfiguration{}
+	if err := yaml.UnmarshalStrict(cfg, &syslogConfig); err != nil {
+		return fmt.Errorf("while parsing syslog acquisition : %s", err)
+	}
+	if syslogConfig.Mode == "" {
+		syslogConfig.Mode = TAILMODE
+	}
+	if syslogConfig.Mode != TAILMODE {
+		return fmt.Errorf("syslog acquisition only supports %s mode", TAILMODE)
+	}
+	if syslogConfig.ListenAddr == "" {
+		syslogConfig.ListenAddr = "127.0.0.1"
+	}
+	if syslogConfig.ListenPort == 0 {
+		syslogConfig.ListenPort = 514
+	}
+	if len(syslogConfig.Protocols) == 0 {
+		syslogConfig.Protocols = []string{"udp"}
+	}
+	for _, proto := range syslogConfig.Protocols {
+		if proto != "udp" && proto != "tcp" {
+			return fmt.Errorf("unknown protocol '%s', expected udp or tcp", proto)
+		}
+	}
+	if syslogConfig.MaxMessageLen == 0 {
+		syslogConfig.MaxMessageLen = 8192
+	}
+	s.config = syslogConfig
+	return nil
+}
+
+func (s *SyslogSource) Mode() string {
+	return s.config.Mode
+}
+
+func (s *SyslogSource) Name() string {
+	return fmt.Sprintf("syslog:%s/%s", s.listenAddr(), strings.Join(s.config.Protocols, ","))
+}
+
+func (s *SyslogSource) listenAddr() string {
+	return net.JoinHostPort(s.config.ListenAddr, strconv.Itoa(s.config.ListenPort))
+}
+
+func (s *SyslogSource) StartReading(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	//open all the listeners before serving, so that none is left open if one of them fails
+	if err := s.listen(); err != nil {
+		s.closeListeners()
+		return err
+	}
+	if s.udpConn != nil {
+		AcquisTomb.Go(func() error {
+			return s.serveUDP(output, AcquisTomb)
+		})
+	}
+	if s.listener != nil {
+		s.conns = make(map[net.Conn]bool)
+		AcquisTomb.Go(func() error {
+			return s.serveTCP(output, AcquisTomb)
+		})
+	}
+	//the listeners are blocking : close them when we're being killed
+	AcquisTomb.Go(func() error {
+		<-AcquisTomb.Dying()
+		log.Infof("Killing syslog server %s", s.listenAddr())
+		s.closeListeners()
+		s.connLock.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.connLock.Unlock()
+		return nil
+	})
+	return nil
+}
+
+func (s *SyslogSource) listen() error {
+	for _, proto := range s.config.Protocols {
+		switch proto {
+		case "udp":
+			addr, err := net.ResolveUDPAddr("udp", s.listenAddr())
+			if err != nil {
+				return fmt.Errorf("while resolving %s : %s", s.listenAddr(), err)
+			}
+			if s.udpConn, err = net.ListenUDP("udp", addr); err != nil {
+				return fmt.Errorf("while listening on udp %s : %s", s.listenAddr(), err)
+			}
+		case "tcp":
+			listener, err := net.Listen("tcp", s.listenAddr())
+			if err != nil {
+				return fmt.Errorf("while listening on tcp %s : %s", s.listenAddr(), err)
+			}
+			s.listener = listener
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSource) closeListeners() {
+	if s.udpConn != nil {
+		s.udpConn.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+func (s *SyslogSource) serveUDP(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	buf := make([]byte, s.config.MaxMessageLen)
+	log.Infof("Starting syslog server on udp %s", s.listenAddr())
+	for {
+		n, remote, err := s.udpConn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-AcquisTomb.Dying():
+				return nil
+			default:
+				return fmt.Errorf("while reading from udp %s : %s", s.listenAddr(), err)
+			}
+		}
+		//the buffer is reused, so the message must be parsed before the next read
+		s.handleMessage(buf[:n], remote.IP.String(), output, AcquisTomb)
+	}
+}
+
+func (s *SyslogSource) serveTCP(output chan types.Event, AcquisTomb *tomb.Tomb) error {
+	log.Infof("Starting syslog server on tcp %s", s.listenAddr())
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-AcquisTomb.Dying():
+				return nil
+			default:
+				return fmt.Errorf("while accepting on tcp %s : %s", s.listenAddr(), err)
+			}
+		}
+		s.connLock.Lock()
+		s.conns[conn] = true
+		s.connLock.Unlock()
+		AcquisTomb.Go(func() error {
+			s.handleTCPConn(conn, output, AcquisTomb)
+			s.connLock.Lock()
+			delete(s.conns, conn)
+			s.connLock.Unlock()
+			return nil
+		})
+	}
+}
+
+func (s *SyslogSource) handleTCPConn(conn net.Conn, output chan types.Event, AcquisTomb *tomb.Tomb) {
+	defer conn.Close()
+	remote := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	clog := log.WithFields(log.Fields{"syslog client": remote})
+	clog.Debugf("new tcp connection")
+	reader := bufio.NewReaderSize(conn, s.config.MaxMessageLen+1)
+	for {
+		msg, err := readTCPFrame(reader, s.config.MaxMessageLen)
+		if err != nil {
+			if err != io.EOF {
+				select {
+				case <-AcquisTomb.Dying():
+				default:
+					clog.Warningf("closing connection : %s", err)
+				}
+			}
+			return
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		s.handleMessage(msg, remote, output, AcquisTomb)
+	}
+}
+
+/*
+ readTCPFrame reads one message, either octet-counted (RFC6587 3.4.1) or newline-terminated (RFC6587 3.4.2).
+ The reader must be able to buffer maxLen+1 bytes : a longer message is an error, and the connection is closed.
+*/
+func readTCPFrame(reader *bufio.Reader, maxLen int) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '0' && first[0] <= '9' {
+		strLen, err := reader.ReadSlice(' ')
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("invalid frame length '%.10s...'", strLen)
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgLen, err := strconv.Atoi(strings.TrimSuffix(string(strLen), " "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame length '%s'", strLen)
+		}
+		if msgLen > maxLen {
+			return nil, fmt.Errorf("frame length %d exceeds %d", msgLen, maxLen)
+		}
+		msg := make([]byte, msgLen)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+	//ReadSlice doesn't read past the buffer, so a peer can't make us buffer an endless line
+	line, err := reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("message exceeds %d bytes without a newline", maxLen)
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+	//the slice is only valid until the next read
+	msg := make([]byte, len(line))
+	copy(msg, line)
+	return msg, nil
+}
+
+func (s *SyslogSource) handleMessage(buf []byte, remote string, output chan types.Event, AcquisTomb *tomb.Tomb) {
+	l := types.Line{}
+
+	msg, err := ParseSyslogMessage(buf)
+	if err != nil {
+		log.Debugf("invalid syslog message from %s (%s) : %s", remote, err, buf)
+		//don't lose the line, parsers might be able to make sense of it
+		l.Raw = strings.TrimRight(string(buf), "\r\n\x00")
+	} else {
+		hostname := msg.Hostname
+		if hostname == "" {
+			hostname = remote
+		}
+		l.Raw = FormatSyslogLine(msg.Timestamp, hostname, msg.AppName, msg.ProcID, msg.Message)
+	}
+	if l.Raw == "" {
+		return
+	}
+	//the clients are countless, label with the listener
+	ReaderHits.With(prometheus.Labels{"source": s.listenAddr()}).Inc()
+	l.Labels = s.config.Labels
+	l.Time = time.Now()
+	l.Src = remote
+	l.Process = true
+	//it's a live stream
+	select {
+	case output <- types.Event{Line: l, Process: true, Type: types.LOG, ExpectMode: leaky.LIVE}:
+	case <-AcquisTomb.Dying():
+	}
+}
@@ -0,0 +1,215 @@
+package acquisition
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/tomb.v2"
+)
+
+func TestParseSyslogMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected SyslogMessage
+		err      bool
+	}{
+		{
+			input: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - BOM'su root' failed for lonvick on /dev/pts/8",
+			expected: SyslogMessage{Facility: 4, Severity: 2, Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname: "mymachine.example.com", AppName: "su", MsgID: "ID47", Message: "BOM'su root' failed for lonvick on /dev/pts/8"},
+		},
+		{
+			input: `<165>1 2003-10-11T22:14:15.003Z host app 1234 - [exampleSDID@32473 iut="3" eventSource="Appl\]ication"][x@1 a="b"] An application event`,
+			expected: SyslogMessage{Facility: 20, Severity: 5, Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname: "host", AppName: "app", ProcID: "1234", Message: "An application event"},
+		},
+		{
+			input:    "<13>1 - - - - - -",
+			expected: SyslogMessage{Facility: 1, Severity: 5},
+		},
+		{
+			input:    "<38>Oct 11 22:14:15 mymachine sshd[4242]: Invalid user toto from 1.2.3.4\n",
+			expected: SyslogMessage{Facility: 4, Severity: 6, Hostname: "mymachine", AppName: "sshd", ProcID: "4242", Message: "Invalid user toto from 1.2.3.4"},
+		},
+		{
+			input:    "<38>Oct  1 22:14:15 sshd: no hostname",
+			expected: SyslogMessage{Facility: 4, Severity: 6, AppName: "sshd", Message: "no hostname"},
+		},
+		{
+			input:    "<38>2003-10-11T22:14:15Z host kernel: iso timestamp",
+			expected: SyslogMessage{Facility: 4, Severity: 6, Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC), Hostname: "host", AppName: "kernel", Message: "iso timestamp"},
+		},
+		{
+			input: "no pri",
+			err:   true,
+		},
+		{
+			input: "<999>1 - - - - -",
+			err:   true,
+		},
+		{
+			input: "<13>Foo 11 22:14:15 bad timestamp",
+			err:   true,
+		},
+	}
+
+	for idx, test := range tests {
+		msg, err := ParseSyslogMessage([]byte(test.input))
+		if test.err {
+			if err == nil {
+				t.Fatalf("test %d : expected error", idx)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d : unexpected error : %s", idx, err)
+		}
+		//rfc3164 timestamps have no year, only check the month/day
+		if test.expected.Timestamp.IsZero() && !msg.Timestamp.IsZero() {
+			assert.Equal(t, time.October, msg.Timestamp.Month(), "test %d", idx)
+			msg.Timestamp = time.Time{}
+		}
+		assert.Equal(t, test.expected, *msg, "test %d", idx)
+	}
+}
+
+func startSyslogSource(t *testing.T, config string) (chan types.Event, *tomb.Tomb) {
+	source, err := DataSourceFromConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	output := make(chan types.Event)
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(output, &acquisTomb); err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	return output, &acquisTomb
+}
+
+func readEvents(output chan types.Event, count int) []types.Event {
+	var ret []types.Event
+	for len(ret) < count {
+		select {
+		case evt := <-output:
+			ret = append(ret, evt)
+		case <-time.After(2 * time.Second):
+			return ret
+		}
+	}
+	return ret
+}
+
+func TestSyslogUDP(t *testing.T) {
+	output, acquisTomb := startSyslogSource(t, "type: syslog\nlisten_port: 45141\nlabels:\n  type: syslog\n")
+
+	conn, err := net.Dial("udp", "127.0.0.1:45141")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("<38>Oct 11 22:14:15 mymachine sshd[4242]: Invalid user toto from 1.2.3.4")); err != nil {
+		t.Fatal(err)
+	}
+	evts := readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "Oct 11 22:14:15 mymachine sshd[4242]: Invalid user toto from 1.2.3.4", evts[0].Line.Raw)
+	assert.Equal(t, "127.0.0.1", evts[0].Line.Src)
+	assert.Equal(t, "syslog", evts[0].Line.Labels["type"])
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	output, acquisTomb := startSyslogSource(t, "type: syslog\nlisten_port: 45142\nprotocols:\n - tcp\nlabels:\n  type: syslog\n")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:45142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg5424 := "<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - 'su root' failed"
+	//octet-counted framing, followed by newline-delimited framing
+	payload := fmt.Sprintf("%d %s", len(msg5424), msg5424) + "<38>Oct 11 22:14:15 host sshd: second\n<38>Oct 11 22:14:15 host sshd: third\n"
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	evts := readEvents(output, 3)
+	if len(evts) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(evts))
+	}
+	expectedTs := time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC).Local().Format(time.Stamp)
+	assert.Equal(t, expectedTs+" mymachine su: 'su root' failed", evts[0].Line.Raw)
+	assert.Equal(t, "Oct 11 22:14:15 host sshd: second", evts[1].Line.Raw)
+	assert.Equal(t, "Oct 11 22:14:15 host sshd: third", evts[2].Line.Raw)
+
+	//the connection is still open, the server must close it on shutdown
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+	conn.Close()
+}
+
+func TestSyslogTCPMaxLen(t *testing.T) {
+	output, acquisTomb := startSyslogSource(t, "type: syslog\nlisten_port: 45145\nprotocols:\n - tcp\nmax_message_len: 64\nlabels:\n  type: syslog\n")
+
+	conn, err := net.Dial("tcp", "127.0.0.1:45145")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	//a message fitting max_message_len is read, an endless line closes the connection
+	payload := "<38>Oct 11 22:14:15 host sshd: short\n" + strings.Repeat("A", 1024)
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		t.Fatal(err)
+	}
+	evts := readEvents(output, 1)
+	if len(evts) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(evts))
+	}
+	assert.Equal(t, "Oct 11 22:14:15 host sshd: short", evts[0].Line.Raw)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	//closed with unread data, the connection might be reset instead
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("expected the connection to be closed")
+	} else if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		t.Fatalf("expected the connection to be closed, got %s", err)
+	}
+
+	acquisTomb.Kill(nil)
+	if err := acquisTomb.Wait(); err != nil {
+		t.Fatalf("acquisition returned error : %s", err)
+	}
+}
+
+func TestSyslogListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:45146")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	source, err := DataSourceFromConfig([]byte("type: syslog\nlisten_port: 45146\nprotocols:\n - udp\n - tcp\n"))
+	if err != nil {
+		t.Fatalf("unexpected error : %s", err)
+	}
+	acquisTomb := tomb.Tomb{}
+	if err := source.StartReading(make(chan types.Event), &acquisTomb); err == nil {
+		t.Fatalf("expected an error as the tcp port is in use")
+	}
+	//the udp listener must have been closed
+	conn, err := net.ListenPacket("udp", "127.0.0.1:45146")
+	if err != nil {
+		t.Fatalf("udp port still in use : %s", err)
+	}
+	conn.Close()
+}
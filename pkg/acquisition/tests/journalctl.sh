@@ -0,0 +1,4 @@
+#!/bin/sh
+#fake journalctl, for tests
+cat "$(dirname "$0")/journal.json"
+exec sleep 30
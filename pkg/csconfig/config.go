@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strconv"
 
 	"os"
 
@@ -20,14 +21,52 @@ type SimulationConfig struct {
 	Exclusions []string `yaml:"exclusions,omitempty"`
 }
 
+// where the unparsed lines are kept
+const (
+	UNPARSEDFILE   = "file"   //rotated file, one json object per line
+	UNPARSEDMEMORY = "memory" //the last lines of each source, served over http
+)
+
+// UnparsedConfig is the configuration of the sink of the lines that no parser understood
+type UnparsedConfig struct {
+	Mode string `yaml:"mode"`
+	//keep one line out of Sampling for each source
+	Sampling int `yaml:"sampling,omitempty"`
+	//how many sources are tracked, the least recently seen one is forgotten beyond
+	MaxSources int `yaml:"max_sources,omitempty"`
+	//file mode
+	Path       string `yaml:"path,omitempty"`
+	MaxSize    int    `yaml:"max_size,omitempty"` //megabytes
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	//memory mode : how many lines are kept for each source, and the address (host:port) they are served on.
+	//the raw lines are served without authentication, keep it on localhost
+	Size   int    `yaml:"size,omitempty"`
+	Listen string `yaml:"listen,omitempty"`
+}
+
+// EnricherConfig is the configuration of one enricher
+type EnricherConfig struct {
+	Disabled bool              `yaml:"disabled,omitempty"`
+	Config   map[string]string `yaml:"config,omitempty"` //given to the Init of the enricher
+}
+
+// EnrichersConfig configures the enrichers by name, and where the enrichment plugins are loaded from
+type EnrichersConfig struct {
+	PluginDir string                    `yaml:"plugin_dir,omitempty"`
+	Enrichers map[string]EnricherConfig `yaml:"enrichers,omitempty"`
+}
+
 // CrowdSec is the structure of the crowdsec configuration
 type CrowdSec struct {
 	WorkingFolder     string    `yaml:"working_dir,omitempty"`
 	DataFolder        string    `yaml:"data_dir,omitempty"`
 	ConfigFolder      string    `yaml:"config_dir,omitempty"`
 	AcquisitionFile   string    `yaml:"acquis_path,omitempty"`
+	PositionsPath     string    `yaml:"positions_path,omitempty"` //where the offsets of tailed files are kept across restarts
 	SingleFile        string    //for forensic mode
 	SingleFileLabel   string    //for forensic mode
+	Replay            bool      //replay SingleFile in live mode, paced by the events timestamps
+	ReplaySpeed       float64   //replay speed factor, 0 is as fast as possible
 	PIDFolder         string    `yaml:"pid_dir,omitempty"`
 	LogFolder         string    `yaml:"log_dir,omitempty"`
 	LogMode           string    `yaml:"log_mode,omitempty"`  //like file, syslog or stdout ?
@@ -46,6 +85,8 @@ type CrowdSec struct {
 	RestoreMode       string
 	DumpBuckets       bool
 	OutputConfig      *outputs.OutputFactory `yaml:"plugin"`
+	Unparsed          *UnparsedConfig        `yaml:"unparsed,omitempty"` //where the lines no parser understood are kept
+	Enrich            *EnrichersConfig       `yaml:"enrich,omitempty"`
 }
 
 // NewCrowdSecConfig create a new crowdsec configuration with default configuration
@@ -114,8 +155,9 @@ func (c *CrowdSec) LoadConfig() error {
 	printVersion := flag.Bool("version", false, "display version")
 	APIMode := flag.Bool("api", false, "perform pushes to api")
 	profileMode := flag.Bool("profile", false, "Enable performance profiling")
-	catFile := flag.String("file", "", "Process a single file in time-machine")
+	catFile := flag.String("file", "", "Process a single file in time-machine (- for stdin)")
 	catFileType := flag.String("type", "", "Labels.type for file in time-machine")
+	replaySpeed := flag.String("replay", "", "Replay -file in live mode at the pace of its timestamps : speed factor (ie. 1, 10) or max")
 	daemonMode := flag.Bool("daemon", false, "Daemonize, go background, drop PID file, log to file")
 	testMode := flag.Bool("t", false, "only test configs")
 	prometheus := flag.Bool("prometheus-metrics", false, "expose http prometheus collector (see http_listen)")
@@ -137,6 +179,20 @@ func (c *CrowdSec) LoadConfig() error {
 		c.SingleFileLabel = *catFileType
 	}
 
+	if *replaySpeed != "" {
+		if *catFile == "" {
+			return fmt.Errorf("-replay requires -file")
+		}
+		c.Replay = true
+		if *replaySpeed != "max" {
+			speed, err := strconv.ParseFloat(*replaySpeed, 64)
+			if err != nil || speed <= 0 {
+				return fmt.Errorf("invalid -replay speed '%s', expected a positive number or max", *replaySpeed)
+			}
+			c.ReplaySpeed = speed
+		}
+	}
+
 	if err := c.LoadConfigurationFile(configFile); err != nil {
 		return fmt.Errorf("Error while loading configuration : %s", err)
 	}
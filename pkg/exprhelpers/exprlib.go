@@ -15,6 +15,7 @@ import (
 
 var dataFile map[string][]string
 var dataFileRegex map[string][]*regexp.Regexp
+var dataFileIP map[string]*IPTree
 
 func Atof(x string) float64 {
 	log.Debugf("debug atof %s", x)
@@ -38,6 +39,7 @@ func GetExprEnv(ctx map[string]interface{}) map[string]interface{} {
 		"RegexpInFile":   RegexpInFile,
 		"Upper":          Upper,
 		"IpInRange":      IpInRange,
+		"IpInFile":       IpInFile,
 	}
 	for k, v := range ctx {
 		ExprLib[k] = v
@@ -48,6 +50,7 @@ func GetExprEnv(ctx map[string]interface{}) map[string]interface{} {
 func Init() error {
 	dataFile = make(map[string][]string)
 	dataFileRegex = make(map[string][]*regexp.Regexp)
+	dataFileIP = make(map[string]*IPTree)
 	return nil
 }
 
@@ -64,6 +67,19 @@ func FileInit(fileFolder string, filename string, fileType string) error {
 		log.Debugf("ignored file %s%s because no type specified", fileFolder, filename)
 		return nil
 	}
+	if fileType == "ip" || fileType == "cidr" {
+		//the ips and ranges are kept in a radix tree rather than a list
+		tree := NewIPTree()
+		invalid, err := tree.Load(file, filename)
+		if err != nil {
+			return err
+		}
+		if invalid > 0 {
+			log.Warningf("%d invalid ips or ranges ignored in %s", invalid, filepath)
+		}
+		dataFileIP[filename] = tree
+		return nil
+	}
 	if _, ok := dataFile[filename]; !ok {
 		dataFile[filename] = []string{}
 	}
@@ -109,6 +125,20 @@ func RegexpInFile(data string, filename string) bool {
 	return false
 }
 
+func IpInFile(ip string, filename string) bool {
+	tree, ok := dataFileIP[filename]
+	if !ok {
+		log.Errorf("file '%s' (type:ip) not found in expr library", filename)
+		return false
+	}
+	ipParsed := net.ParseIP(ip)
+	if ipParsed == nil {
+		log.Debugf("'%s' is not a valid IP", ip)
+		return false
+	}
+	return tree.Contains(ipParsed)
+}
+
 func IpInRange(ip string, ipRange string) bool {
 	var err error
 	var ipParsed net.IP
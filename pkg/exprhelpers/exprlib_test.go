@@ -281,6 +281,69 @@ func TestFile(t *testing.T) {
 	}
 }
 
+func TestIpInFile(t *testing.T) {
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := FileInit(TestFolder, "test_data_ip.txt", "cidr")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		result bool
+	}{
+		{
+			name:   "IpInFile() test: ip in file",
+			filter: "IpInFile('192.168.1.1', 'test_data_ip.txt')",
+			result: true,
+		},
+		{
+			name:   "IpInFile() test: ip in a range of the file",
+			filter: "IpInFile('10.2.3.4', 'test_data_ip.txt')",
+			result: true,
+		},
+		{
+			name:   "IpInFile() test: ipv6 in a range of the file",
+			filter: "IpInFile('2001:db8::42', 'test_data_ip.txt')",
+			result: true,
+		},
+		{
+			name:   "IpInFile() test: ip not in file",
+			filter: "IpInFile('192.168.1.2', 'test_data_ip.txt')",
+			result: false,
+		},
+		{
+			name:   "IpInFile() test: malformed ip",
+			filter: "IpInFile('192.168.1', 'test_data_ip.txt')",
+			result: false,
+		},
+		{
+			name:   "IpInFile() test: filepath provided doesn't exist",
+			filter: "IpInFile('192.168.1.1', 'non_existing_data.txt')",
+			result: false,
+		},
+	}
+
+	for _, test := range tests {
+		compiledFilter, err := expr.Compile(test.filter, expr.Env(GetExprEnv(map[string]interface{}{})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := expr.Run(compiledFilter, GetExprEnv(map[string]interface{}{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isOk := assert.Equal(t, test.result, result); !isOk {
+			t.Fatalf("test '%s' : NOK", test.name)
+		}
+		log.Printf("test '%s' : OK", test.name)
+	}
+}
+
 func TestIpInRange(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -0,0 +1,194 @@
+package exprhelpers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+/*
+ IPTree is a radix tree of ip ranges, each one tagged with values (ie. the names of the lists it comes from).
+ Single ips are /32 (or /128) ranges, and ipv4 is stored as ipv4-mapped ipv6, so that both share the tree.
+ It's not safe for concurrent writes, but can be looked up concurrently once built.
+*/
+type IPTree struct {
+	root *ipTreeNode
+	size int
+}
+
+type ipTreeNode struct {
+	prefix   net.IP //16 bytes, masked to bits
+	bits     int
+	values   []string //empty for the nodes that only split the tree
+	children [2]*ipTreeNode
+}
+
+func NewIPTree() *IPTree {
+	return &IPTree{}
+}
+
+//ParseIPRange parses an ip or a range in CIDR notation
+func ParseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return ipnet, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip '%s'", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+//to16 returns the ipv6 form of ipnet, and its prefix length in that form
+func to16(ipnet *net.IPNet) (net.IP, int) {
+	ones, bits := ipnet.Mask.Size()
+	if bits == 32 {
+		ones += 96
+	}
+	return ipnet.IP.To16().Mask(net.CIDRMask(ones, 128)), ones
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+//commonBits returns the length of the common prefix of a and b, up to max
+func commonBits(a net.IP, b net.IP, max int) int {
+	for i := 0; i < max; i++ {
+		if ipBit(a, i) != ipBit(b, i) {
+			return i
+		}
+	}
+	return max
+}
+
+//Insert adds the range ipnet to the tree, tagged with value
+func (t *IPTree) Insert(ipnet *net.IPNet, value string) {
+	prefix, bits := to16(ipnet)
+	node := &t.root
+	for {
+		cur := *node
+		if cur == nil {
+			*node = &ipTreeNode{prefix: prefix, bits: bits, values: []string{value}}
+			t.size++
+			return
+		}
+		common := commonBits(cur.prefix, prefix, min(cur.bits, bits))
+		if common == cur.bits {
+			if bits == cur.bits {
+				if len(cur.values) == 0 {
+					t.size++
+				}
+				for _, v := range cur.values {
+					if v == value {
+						return
+					}
+				}
+				cur.values = append(cur.values, value)
+				return
+			}
+			//the range is within cur
+			node = &cur.children[ipBit(prefix, cur.bits)]
+			continue
+		}
+		//cur and the range diverge, or the range contains cur : split on their common prefix
+		split := &ipTreeNode{prefix: prefix.Mask(net.CIDRMask(common, 128)), bits: common}
+		split.children[ipBit(cur.prefix, common)] = cur
+		if common == bits {
+			split.values = []string{value}
+		} else {
+			split.children[ipBit(prefix, common)] = &ipTreeNode{prefix: prefix, bits: bits, values: []string{value}}
+		}
+		*node = split
+		t.size++
+		return
+	}
+}
+
+//Lookup returns the values of all the ranges containing ip, from the largest range to the smallest one
+func (t *IPTree) Lookup(ip net.IP) []string {
+	var ret []string
+
+	ip = ip.To16()
+	if ip == nil {
+		return nil
+	}
+	for node := t.root; node != nil; {
+		if commonBits(node.prefix, ip, node.bits) != node.bits {
+			break
+		}
+		for _, v := range node.values {
+			found := false
+			for _, r := range ret {
+				if r == v {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ret = append(ret, v)
+			}
+		}
+		if node.bits == 128 {
+			break
+		}
+		node = node.children[ipBit(ip, node.bits)]
+	}
+	return ret
+}
+
+//Contains tells if ip is within any range of the tree
+func (t *IPTree) Contains(ip net.IP) bool {
+	return len(t.Lookup(ip)) > 0
+}
+
+//Len returns the number of distinct ranges in the tree
+func (t *IPTree) Len() int {
+	return t.size
+}
+
+/*
+ Load inserts the ips and ranges of r, one per line, tagged with value. Empty lines and comments (#) are ignored,
+ as well as what follows the first field of a line (ie. "1.2.3.0/24 ; SBL123"). It returns the number of invalid lines.
+*/
+func (t *IPTree) Load(r io.Reader, value string) (int, error) {
+	invalid := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ';' || r == ','
+		})
+		//a line of separators only
+		if len(fields) == 0 {
+			invalid++
+			continue
+		}
+		ipnet, err := ParseIPRange(fields[0])
+		if err != nil {
+			invalid++
+			continue
+		}
+		t.Insert(ipnet, value)
+	}
+	return invalid, scanner.Err()
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
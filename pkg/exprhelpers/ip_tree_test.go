@@ -0,0 +1,78 @@
+package exprhelpers
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIPTree(t *testing.T) {
+	tree := NewIPTree()
+	for _, r := range []struct {
+		ipRange string
+		value   string
+	}{
+		{"10.1.2.3", "host"},
+		{"10.1.0.0/16", "small"},
+		{"10.0.0.0/8", "large"},
+		{"10.1.2.3/32", "other"},
+		{"10.1.2.3", "host"}, //duplicate
+		{"10.2.0.0/16", "sibling"},
+		{"192.168.0.0/24", "lan"},
+		{"2001:db8::/32", "v6"},
+		{"2001:db8::1", "v6host"},
+	} {
+		ipnet, err := ParseIPRange(r.ipRange)
+		if err != nil {
+			t.Fatalf("unable to parse %s : %s", r.ipRange, err)
+		}
+		tree.Insert(ipnet, r.value)
+	}
+	if tree.Len() != 7 {
+		t.Fatalf("expected 7 ranges, got %d", tree.Len())
+	}
+	for _, tc := range []struct {
+		ip       string
+		expected []string
+	}{
+		{"10.1.2.3", []string{"large", "small", "host", "other"}},
+		{"10.1.2.4", []string{"large", "small"}},
+		{"10.2.255.255", []string{"large", "sibling"}},
+		{"10.3.0.1", []string{"large"}},
+		{"11.0.0.1", nil},
+		{"192.168.0.255", []string{"lan"}},
+		{"192.168.1.0", nil},
+		{"2001:db8::1", []string{"v6", "v6host"}},
+		{"2001:db8:ffff::1", []string{"v6"}},
+		{"2001:db9::1", nil},
+		//ipv4-mapped ipv6 is ipv4
+		{"::ffff:10.3.0.1", []string{"large"}},
+	} {
+		ret := tree.Lookup(net.ParseIP(tc.ip))
+		if !reflect.DeepEqual(ret, tc.expected) {
+			t.Fatalf("%s : expected %v, got %v", tc.ip, tc.expected, ret)
+		}
+		if tree.Contains(net.ParseIP(tc.ip)) != (len(tc.expected) > 0) {
+			t.Fatalf("%s : unexpected Contains()", tc.ip)
+		}
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "10.0.0", "foo"} {
+		if _, err := ParseIPRange(invalid); err == nil {
+			t.Fatalf("expected error for %s", invalid)
+		}
+	}
+
+	tree = NewIPTree()
+	invalid, err := tree.Load(strings.NewReader("# comment\n\n1.2.3.4\n5.6.7.0/24 ; SBL123\n2001:db8::1\tfoo\nnot an ip\n,\n , ,\n"), "list")
+	if err != nil {
+		t.Fatalf("unable to load : %s", err)
+	}
+	if invalid != 3 || tree.Len() != 3 {
+		t.Fatalf("expected 3 ranges and 3 invalid lines, got %d and %d", tree.Len(), invalid)
+	}
+	if !tree.Contains(net.ParseIP("5.6.7.8")) || tree.Contains(net.ParseIP("5.6.8.1")) {
+		t.Fatalf("unexpected lookup of 5.6.7.0/24")
+	}
+}
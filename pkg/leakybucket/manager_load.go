@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/crowdsecurity/crowdsec/pkg/cwversion"
@@ -59,6 +60,7 @@ type BucketFactory struct {
 	ret            chan types.Event          //the bucket-specific output chan for overflows
 	processors     []Processor               //processors is the list of hooks for pour/overflow/create (cf. uniq, blackhole etc.)
 	output         bool                      //??
+	filterWarning  *sync.Once                //the errors of the filter are logged as a warning once, and then at debug level
 }
 
 func ValidateFactory(b *BucketFactory) error {
@@ -230,6 +232,7 @@ func LoadBucket(g *BucketFactory, dataFolder string) error {
 	if err != nil {
 		return fmt.Errorf("invalid filter '%s' in %s : %v", g.Filter, g.Filename, err)
 	}
+	g.filterWarning = &sync.Once{}
 	if g.Debug {
 		g.ExprDebugger, err = exprhelpers.NewDebugger(g.Filter, expr.Env(exprhelpers.GetExprEnv(map[string]interface{}{"evt": &types.Event{}})))
 		if err != nil {
@@ -335,6 +338,12 @@ func LoadBucketsState(file string, buckets *Buckets, holders []BucketFactory) er
 				}
 				/*Trying to restore queue state*/
 				tbucket.Queue = v.Queue
+				/*only the types of the typed entries are serialized, derive their values again*/
+				if tbucket.Queue != nil {
+					for idx := range tbucket.Queue.Queue {
+						tbucket.Queue.Queue[idx].RefreshTyped()
+					}
+				}
 				/*Trying to set the limiter to the saved values*/
 				tbucket.Limiter.Load(v.SerializedState)
 				tbucket.In = make(chan types.Event)
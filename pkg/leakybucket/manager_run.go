@@ -19,6 +19,11 @@ import (
 
 var serialized map[string]Leaky
 
+/*BucketPourTrack makes PourItemToHolders record, for each scenario, the events that matched its filter in BucketPourCache.
+It's meant to explain how events are processed, and isn't safe with concurrent pours.*/
+var BucketPourTrack bool
+var BucketPourCache map[string][]types.Event
+
 /*The leaky routines lifecycle are based on "real" time.
 But when we are running in time-machine mode, the reference time is in logs and not "real" time.
 Thus we need to garbage collect them to avoid a skyrocketing memory usage.*/
@@ -145,14 +150,23 @@ func PourItemToHolders(parsed types.Event, holders []BucketFactory, buckets *Buc
 		err                 error
 	)
 
+	//the events that didn't go through the parsers (ie. replayed or restored ones) get their typed values too
+	parsed.RefreshTyped()
 	for idx, holder := range holders {
 
 		if holder.RunTimeFilter != nil {
 			log.Debugf("event against holder %d/%d", idx, len(holders))
 			output, err := expr.Run(holder.RunTimeFilter, exprhelpers.GetExprEnv(map[string]interface{}{"evt": &parsed}))
+			//a filter failing on this event doesn't concern the other holders, and it's likely to fail on the next ones
 			if err != nil {
-				holder.logger.Errorf("failed parsing : %v", err)
-				return false, fmt.Errorf("leaky failed : %s", err)
+				if holder.filterWarning != nil {
+					holder.filterWarning.Do(func() {
+						holder.logger.Warningf("failed to run filter : %v (the next errors are logged at debug level)", err)
+					})
+				}
+				holder.logger.Debugf("failed to run filter : %v", err)
+				holder.logger.Debugf("Event leaving node : ko")
+				continue
 			}
 			// we assume we a bool should add type check here
 			if condition, ok = output.(bool); !ok {
@@ -168,6 +182,12 @@ func PourItemToHolders(parsed types.Event, holders []BucketFactory, buckets *Buc
 				continue
 			}
 		}
+		if BucketPourTrack {
+			if BucketPourCache == nil {
+				BucketPourCache = make(map[string][]types.Event)
+			}
+			BucketPourCache[holder.Name] = append(BucketPourCache[holder.Name], parsed)
+		}
 
 		sent = false
 		var groupby string
@@ -22,6 +22,37 @@ func expectBucketCount(buckets *Buckets, expected int) error {
 
 }
 
+func TestBucketPourTrack(t *testing.T) {
+	var buckets *Buckets = NewBuckets()
+
+	var Holders = []BucketFactory{
+		BucketFactory{Name: "test_match", Description: "test_match", Type: "counter", Capacity: -1, Duration: "10m", Filter: "evt.Parsed.something == 'something'"},
+		BucketFactory{Name: "test_no_match", Description: "test_no_match", Type: "counter", Capacity: -1, Duration: "10m", Filter: "evt.Parsed.something == 'else'"},
+	}
+	for idx := range Holders {
+		if err := LoadBucket(&Holders[idx], "."); err != nil {
+			t.Fatalf("while loading (%d/%d): %s", idx, len(Holders), err)
+		}
+	}
+
+	BucketPourTrack = true
+	BucketPourCache = nil
+	defer func() {
+		BucketPourTrack = false
+		BucketPourCache = nil
+	}()
+	var in = types.Event{Parsed: map[string]string{"something": "something"}, ExpectMode: LIVE}
+	if _, err := PourItemToHolders(in, Holders, buckets); err != nil {
+		t.Fatalf("while pouring item : %s", err)
+	}
+	if len(BucketPourCache) != 1 || len(BucketPourCache["test_match"]) != 1 {
+		t.Fatalf("expected the event to be tracked for test_match only, got %+v", BucketPourCache)
+	}
+	if err := ShutdownAllBuckets(buckets); err != nil {
+		t.Fatalf("failed to shutdown buckets : %s", err)
+	}
+}
+
 func TestGCandDump(t *testing.T) {
 	var buckets *Buckets = NewBuckets()
 
@@ -0,0 +1,69 @@
+package leakybucket
+
+import (
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+ Pacer replays historical events in LIVE mode : the events are delayed so that the time elapsed between them
+ is the one between their timestamps, divided by Speed. A Speed of 0 pours them as fast as possible.
+ Events without timestamp, or older than the previous one, are poured right away.
+*/
+type Pacer struct {
+	Speed      float64
+	firstEvent time.Time //the timestamp of the first event
+	start      time.Time //when the first event was poured
+	lastEvent  time.Time
+}
+
+func NewPacer(speed float64) *Pacer {
+	return &Pacer{Speed: speed}
+}
+
+//Delay returns how long the event must be held, it must be poured right after
+func (p *Pacer) Delay(evt types.Event) time.Duration {
+	var evtTime time.Time
+
+	if evt.MarshaledTime == "" {
+		return 0
+	}
+	if err := evtTime.UnmarshalText([]byte(evt.MarshaledTime)); err != nil {
+		log.Debugf("replay : failed unmarshaling event time (%s) : %v", evt.MarshaledTime, err)
+		return 0
+	}
+	if p.firstEvent.IsZero() {
+		p.firstEvent = evtTime
+		p.lastEvent = evtTime
+		p.start = time.Now()
+		return 0
+	}
+	if p.Speed == 0 || evtTime.Before(p.lastEvent) {
+		return 0
+	}
+	p.lastEvent = evtTime
+	target := time.Duration(float64(evtTime.Sub(p.firstEvent)) / p.Speed)
+	if delay := target - time.Since(p.start); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+//Wait holds the event until it's time to pour it, and switches it to LIVE mode. It returns false if dying is closed meanwhile
+func (p *Pacer) Wait(evt *types.Event, dying <-chan struct{}) bool {
+	evt.ExpectMode = LIVE
+	delay := p.Delay(*evt)
+	if delay == 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-dying:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package leakybucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+)
+
+func replayEvent(t *testing.T, ts time.Time) types.Event {
+	marshaled, err := ts.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Event{Type: types.LOG, ExpectMode: TIMEMACHINE, MarshaledTime: string(marshaled)}
+}
+
+func TestPacer(t *testing.T) {
+	first := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	dying := make(chan struct{})
+
+	//one second between the events, replayed 10 times faster
+	pacer := NewPacer(10)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		evt := replayEvent(t, first.Add(time.Duration(i)*time.Second))
+		if !pacer.Wait(&evt, dying) {
+			t.Fatalf("pacer returned false")
+		}
+		if evt.ExpectMode != LIVE {
+			t.Fatalf("expected LIVE mode, got %d", evt.ExpectMode)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 600*time.Millisecond {
+		t.Fatalf("expected the replay to last 300ms, got %s", elapsed)
+	}
+
+	//events without time, or out of order, aren't delayed
+	if delay := pacer.Delay(types.Event{}); delay != 0 {
+		t.Fatalf("expected no delay without time, got %s", delay)
+	}
+	if delay := pacer.Delay(replayEvent(t, first)); delay != 0 {
+		t.Fatalf("expected no delay for an older event, got %s", delay)
+	}
+	if delay := pacer.Delay(replayEvent(t, first.Add(time.Hour))); delay < 5*time.Minute {
+		t.Fatalf("expected a 6 minutes delay, got %s", delay)
+	}
+
+	//as fast as possible
+	pacer = NewPacer(0)
+	for i := 0; i < 2; i++ {
+		if delay := pacer.Delay(replayEvent(t, first.Add(time.Duration(i)*time.Hour))); delay != 0 {
+			t.Fatalf("expected no delay, got %s", delay)
+		}
+	}
+
+	//a waiting event is abandoned on shutdown
+	pacer = NewPacer(1)
+	evt := replayEvent(t, first)
+	pacer.Wait(&evt, dying)
+	evt = replayEvent(t, first.Add(time.Hour))
+	close(dying)
+	if pacer.Wait(&evt, dying) {
+		t.Fatalf("pacer should have returned false")
+	}
+}
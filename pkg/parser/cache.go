@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	expires time.Time //zero if the entry never expires
+}
+
+//lruCall is a load in progress, the other callers of the same key wait for it
+type lruCall struct {
+	done  chan struct{}
+	value interface{}
+}
+
+//lruCache is a LRU cache for the results of the enrichers, safe for concurrent use
+type lruCache struct {
+	lock    sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List //most recently used first
+	loading map[string]*lruCall
+}
+
+//newLruCache returns a cache of size entries, a size of 0 disables the cache
+func newLruCache(size int) *lruCache {
+	return &lruCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		loading: make(map[string]*lruCall),
+	}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.getLocked(key)
+}
+
+//add stores value for ttl, or until it's evicted if ttl is 0
+func (c *lruCache) add(key string, value interface{}, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.addLocked(key, value, ttl)
+}
+
+/*
+ load returns the cached value of key, or calls fn to get it and how long to keep it.
+ The concurrent loads of a key wait for the first one instead of calling fn again,
+ hit is false only for the caller that called fn.
+*/
+func (c *lruCache) load(key string, fn func() (interface{}, time.Duration)) (value interface{}, hit bool) {
+	c.lock.Lock()
+	if value, ok := c.getLocked(key); ok {
+		c.lock.Unlock()
+		return value, true
+	}
+	if call, ok := c.loading[key]; ok {
+		c.lock.Unlock()
+		<-call.done
+		return call.value, true
+	}
+	call := &lruCall{done: make(chan struct{})}
+	c.loading[key] = call
+	c.lock.Unlock()
+
+	value, ttl := fn()
+	call.value = value
+
+	c.lock.Lock()
+	delete(c.loading, key)
+	c.addLocked(key, value, ttl)
+	c.lock.Unlock()
+	close(call.done)
+	return value, false
+}
+
+func (c *lruCache) getLocked(key string) (interface{}, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *lruCache) addLocked(key string, value interface{}, ttl time.Duration) {
+	if c.size == 0 {
+		return
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLruCache(t *testing.T) {
+	cache := newLruCache(2)
+	cache.add("1.1.1.1", "one.", 0)
+	cache.add("2.2.2.2", "two.", time.Minute)
+	//1.1.1.1 is now the most recently used
+	if name, ok := cache.get("1.1.1.1"); !ok || name.(string) != "one." {
+		t.Fatalf("expected 'one.', got '%v' (%t)", name, ok)
+	}
+	cache.add("3.3.3.3", "", time.Minute)
+	if _, ok := cache.get("2.2.2.2"); ok {
+		t.Fatalf("expected 2.2.2.2 to be evicted")
+	}
+	if name, ok := cache.get("3.3.3.3"); !ok || name.(string) != "" {
+		t.Fatalf("expected an empty entry for 3.3.3.3, got '%v' (%t)", name, ok)
+	}
+	if _, ok := cache.get("1.1.1.1"); !ok {
+		t.Fatalf("expected 1.1.1.1 to be kept")
+	}
+
+	//expiration
+	cache.add("4.4.4.4", "four.", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := cache.get("4.4.4.4"); ok {
+		t.Fatalf("expected 4.4.4.4 to expire")
+	}
+
+	//disabled
+	cache = newLruCache(0)
+	cache.add("1.1.1.1", "one.", 0)
+	if _, ok := cache.get("1.1.1.1"); ok {
+		t.Fatalf("expected the cache to be disabled")
+	}
+}
+
+func TestLruCacheLoad(t *testing.T) {
+	var calls int32
+	cache := newLruCache(10)
+	fn := func() (interface{}, time.Duration) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return "one.", time.Minute
+	}
+
+	//concurrent misses of the same key only call fn once
+	var wg sync.WaitGroup
+	hits := int32(0)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, hit := cache.load("1.1.1.1", fn)
+			if value.(string) != "one." {
+				t.Errorf("expected 'one.', got '%v'", value)
+			}
+			if hit {
+				atomic.AddInt32(&hits, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+	if hits != 9 {
+		t.Fatalf("expected 9 hits, got %d", hits)
+	}
+	if _, hit := cache.load("1.1.1.1", fn); !hit || calls != 1 {
+		t.Fatalf("expected 1.1.1.1 to be cached")
+	}
+
+	//the disabled cache still shares the loads in progress, but doesn't keep them
+	cache = newLruCache(0)
+	if _, hit := cache.load("1.1.1.1", fn); hit || calls != 2 {
+		t.Fatalf("expected a call for 1.1.1.1")
+	}
+	if _, hit := cache.load("1.1.1.1", fn); hit || calls != 3 {
+		t.Fatalf("expected another call for 1.1.1.1")
+	}
+}
@@ -1,10 +1,18 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
 	"plugin"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
 	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,35 +27,217 @@ type EnricherCtx struct {
 	Name       string
 	Path       string      //path to .so ?
 	RuntimeCtx interface{} //the internal context of plugin, given back over every call
+	Status     error       //why the enricher can't be used, nil when it's healthy
 	initiated  bool
 }
 
-/* mimic plugin loading */
-func Loadplugin(path string) (EnricherCtx, error) {
-	var err error
+var ErrEnricherDisabled = errors.New("disabled by configuration")
 
-	c := EnricherCtx{}
-	c.Name = path
-	c.Path = path
-	/* we don't want to deal with plugin loading for now :p */
-	c.Funcs = map[string]EnrichFunc{
-		"GeoIpASN":    GeoIpASN,
-		"GeoIpCity":   GeoIpCity,
-		"reverse_dns": reverse_dns,
-		"ParseDate":   ParseDate,
-		"IpToRange":   IpToRange,
+var EnricherHealthy = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "cs_enricher_healthy",
+		Help: "Whether the enricher is initialized and usable.",
+	},
+	[]string{"name"},
+)
+
+var EnricherErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cs_enricher_errors_total",
+		Help: "Total errors returned by the methods of the enricher.",
+	},
+	[]string{"name"},
+)
+
+//the compiled-in enrichers, by name
+var registeredEnrichers = make(map[string]EnricherCtx)
+
+//RegisterEnricher makes a compiled-in enricher available. init can be nil if the enricher doesn't need any
+func RegisterEnricher(name string, init InitFunc, funcs map[string]EnrichFunc) error {
+	if name == "" || strings.Contains(name, ".") {
+		return fmt.Errorf("invalid enricher name '%s'", name)
+	}
+	if _, ok := registeredEnrichers[name]; ok {
+		return fmt.Errorf("enricher '%s' is already registered", name)
+	}
+	registeredEnrichers[name] = EnricherCtx{Name: name, Init: init, Funcs: funcs}
+	return nil
+}
+
+func init() {
+	if err := RegisterEnricher("date", nil, map[string]EnrichFunc{"ParseDate": ParseDate}); err != nil {
+		log.Fatalf("%s", err)
 	}
-	c.Init = GeoIpInit
+}
 
-	c.RuntimeCtx, err = c.Init(map[string]string{"datadir": path})
+/*
+ loadEnricherPlugin opens a go plugin (.so), named after its file. It must export :
+  - ExportedFuncs, a []string of the names of its methods, that are EnrichFunc
+  - optionally Init, an InitFunc
+*/
+func loadEnricherPlugin(path string) (EnricherCtx, error) {
+	c := EnricherCtx{
+		Name:  strings.TrimSuffix(filepath.Base(path), ".so"),
+		Path:  path,
+		Funcs: make(map[string]EnrichFunc),
+	}
+	if c.Name == "" || strings.Contains(c.Name, ".") {
+		return c, fmt.Errorf("invalid enricher name '%s'", c.Name)
+	}
+	p, err := plugin.Open(path)
+	if err != nil {
+		return c, fmt.Errorf("while opening plugin %s : %s", path, err)
+	}
+	c.Plugin = p
+	sym, err := p.Lookup("ExportedFuncs")
 	if err != nil {
-		log.Warningf("load (fake) plugin load : %v", err)
-		c.initiated = false
+		return c, fmt.Errorf("plugin %s : %s", path, err)
+	}
+	exported, ok := sym.(*[]string)
+	if !ok {
+		return c, fmt.Errorf("plugin %s : ExportedFuncs is a %T, expected []string", path, sym)
+	}
+	for _, name := range *exported {
+		sym, err := p.Lookup(name)
+		if err != nil {
+			return c, fmt.Errorf("plugin %s : %s", path, err)
+		}
+		fptr, ok := sym.(func(string, *types.Event, interface{}) (map[string]string, error))
+		if !ok {
+			return c, fmt.Errorf("plugin %s : %s is a %T, expected an enrichment function", path, name, sym)
+		}
+		c.Funcs[name] = fptr
+	}
+	if sym, err := p.Lookup("Init"); err == nil {
+		initFunc, ok := sym.(func(map[string]string) (interface{}, error))
+		if !ok {
+			return c, fmt.Errorf("plugin %s : Init is a %T, expected an init function", path, sym)
+		}
+		c.Init = initFunc
 	}
-	c.initiated = true
 	return c, nil
 }
 
+/*
+ LoadEnrichers initializes the compiled-in enrichers and the ones of the plugin directory.
+ Each one gets its own configuration, with 'datadir' set to dataDir unless overridden.
+ The enrichers that are disabled or fail to initialize are returned too, with their Status set,
+ so that the nodes using them can be told apart from the ones using unknown methods.
+*/
+func LoadEnrichers(cfg csconfig.EnrichersConfig, dataDir string) ([]EnricherCtx, error) {
+	var ret []EnricherCtx
+
+	enrichers := make(map[string]EnricherCtx)
+	for name, c := range registeredEnrichers {
+		enrichers[name] = c
+	}
+	if cfg.PluginDir != "" {
+		files, err := filepath.Glob(filepath.Join(cfg.PluginDir, "*.so"))
+		if err != nil {
+			return nil, fmt.Errorf("while listing enrichment plugins : %s", err)
+		}
+		for _, file := range files {
+			c, err := loadEnricherPlugin(file)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := enrichers[c.Name]; ok {
+				return nil, fmt.Errorf("plugin %s : enricher '%s' already exists", file, c.Name)
+			}
+			enrichers[c.Name] = c
+		}
+	}
+	for name := range cfg.Enrichers {
+		if _, ok := enrichers[name]; !ok {
+			return nil, fmt.Errorf("unknown enricher '%s' in configuration", name)
+		}
+	}
+
+	names := make([]string, 0, len(enrichers))
+	for name := range enrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := enrichers[name]
+		c.RuntimeCtx, c.Status, c.initiated = nil, nil, false
+		if cfg.Enrichers[name].Disabled {
+			log.Infof("enricher %s is disabled", name)
+			c.Status = ErrEnricherDisabled
+			ret = append(ret, c)
+			continue
+		}
+		initCfg := map[string]string{"datadir": dataDir}
+		for k, v := range cfg.Enrichers[name].Config {
+			initCfg[k] = v
+		}
+		if c.Init != nil {
+			c.RuntimeCtx, c.Status = c.Init(initCfg)
+		}
+		if c.Status != nil {
+			log.Warningf("enricher %s failed to initialize, its methods will be skipped : %s", name, c.Status)
+			EnricherHealthy.With(prometheus.Labels{"name": name}).Set(0)
+		} else {
+			c.initiated = true
+			EnricherHealthy.With(prometheus.Labels{"name": name}).Set(1)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+//CloseEnrichers releases the resources of the enrichers whose context is an io.Closer (ie. before loading them again)
+func CloseEnrichers(enrichers []EnricherCtx) {
+	for _, c := range enrichers {
+		closer, ok := c.RuntimeCtx.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			log.Warningf("while closing enricher %s : %s", c.Name, err)
+		}
+	}
+}
+
+/*
+ findMethod returns the enricher of a method. The method is either namespaced
+ (ie. geoip.GeoIpCity) or a bare name, that must then be unique among the enrichers.
+ The enricher is returned even if it's not initialized.
+*/
+func findMethod(method string) (*EnricherCtx, EnrichFunc, error) {
+	if idx := strings.Index(method, "."); idx >= 0 {
+		name, fname := method[:idx], method[idx+1:]
+		for i := range ECTX {
+			if ECTX[i].Name != name {
+				continue
+			}
+			if fptr, ok := ECTX[i].Funcs[fname]; ok {
+				return &ECTX[i], fptr, nil
+			}
+			return nil, nil, fmt.Errorf("enricher '%s' has no method '%s'", name, fname)
+		}
+		return nil, nil, fmt.Errorf("unknown enricher '%s' for method '%s'", name, method)
+	}
+
+	var found *EnricherCtx
+	var foundFunc EnrichFunc
+	var candidates []string
+	for i := range ECTX {
+		if fptr, ok := ECTX[i].Funcs[method]; ok {
+			found, foundFunc = &ECTX[i], fptr
+			candidates = append(candidates, ECTX[i].Name+"."+method)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return nil, nil, fmt.Errorf("unknown method '%s'", method)
+	case 1:
+		return found, foundFunc, nil
+	default:
+		return nil, nil, fmt.Errorf("method '%s' is ambiguous, use one of %s", method, strings.Join(candidates, ", "))
+	}
+}
+
 func GenDateParse(date string) (string, time.Time) {
 	var retstr string
 	var layouts = [...]string{
@@ -1,9 +1,14 @@
 package parser
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 	//"github.com/crowdsecurity/crowdsec/pkg/parser"
 )
@@ -11,17 +16,149 @@ import (
 /* All plugins must export a list of function pointers for exported symbols */
 //var ExportedFuncs = []string{"reverse_dns"}
 
+func init() {
+	if err := RegisterEnricher("dns", DnsInit, map[string]EnrichFunc{"reverse_dns": reverse_dns}); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+var ReverseDnsCacheHits = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "cs_reverse_dns_cache_hits_total",
+		Help: "Total reverse dns lookups answered from the cache.",
+	},
+)
+
+var ReverseDnsCacheMisses = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "cs_reverse_dns_cache_misses_total",
+		Help: "Total reverse dns lookups sent to the resolver.",
+	},
+)
+
+type DnsEnricherCtx struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+	//only keep the names that resolve back to the ip
+	forwardConfirm bool
+	cache          *lruCache
+	ttl            time.Duration
+	negativeTTL    time.Duration
+}
+
+/*
+ DnsInit configures reverse_dns. All the settings are optional :
+  - resolver : address (host:port) of the dns server to use instead of the system's one
+  - timeout : of a lookup (default 1s)
+  - forward_confirm : only keep the names that resolve back to the ip (default false)
+  - cache_size : how many lookups are cached (default 1000)
+  - cache_ttl, negative_cache_ttl : how long successful and failed lookups are cached (default 10m and 1m)
+*/
+func DnsInit(cfg map[string]string) (interface{}, error) {
+	var err error
+
+	ctx := &DnsEnricherCtx{resolver: net.DefaultResolver, timeout: time.Second}
+	if cfg["resolver"] != "" {
+		server := cfg["resolver"]
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, fmt.Errorf("invalid resolver '%s' : %s", server, err)
+		}
+		ctx.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(dctx context.Context, network string, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(dctx, network, server)
+			},
+		}
+	}
+	if cfg["timeout"] != "" {
+		if ctx.timeout, err = time.ParseDuration(cfg["timeout"]); err != nil {
+			return nil, fmt.Errorf("invalid timeout '%s' : %s", cfg["timeout"], err)
+		}
+	}
+	if cfg["forward_confirm"] != "" {
+		if ctx.forwardConfirm, err = strconv.ParseBool(cfg["forward_confirm"]); err != nil {
+			return nil, fmt.Errorf("invalid forward_confirm '%s' : %s", cfg["forward_confirm"], err)
+		}
+	}
+	size := 1000
+	if cfg["cache_size"] != "" {
+		if size, err = strconv.Atoi(cfg["cache_size"]); err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid cache_size '%s'", cfg["cache_size"])
+		}
+	}
+	ctx.ttl, ctx.negativeTTL = 10*time.Minute, time.Minute
+	if cfg["cache_ttl"] != "" {
+		if ctx.ttl, err = time.ParseDuration(cfg["cache_ttl"]); err != nil {
+			return nil, fmt.Errorf("invalid cache_ttl '%s' : %s", cfg["cache_ttl"], err)
+		}
+	}
+	if cfg["negative_cache_ttl"] != "" {
+		if ctx.negativeTTL, err = time.ParseDuration(cfg["negative_cache_ttl"]); err != nil {
+			return nil, fmt.Errorf("invalid negative_cache_ttl '%s' : %s", cfg["negative_cache_ttl"], err)
+		}
+	}
+	ctx.cache = newLruCache(size)
+	return ctx, nil
+}
+
 func reverse_dns(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
-	ret := make(map[string]string)
 	if field == "" {
 		return nil, nil
 	}
-	rets, err := net.LookupAddr(field)
-	if err != nil {
-		log.Debugf("failed to resolve '%s'", field)
+	ip := net.ParseIP(field)
+	if ip == nil {
+		log.Debugf("can't parse ip '%s', no reverse dns", field)
+		return nil, nil
+	}
+	dnsCtx := ctx.(*DnsEnricherCtx)
+	//the concurrent lookups of the same ip share the first one
+	cached, hit := dnsCtx.cache.load(ip.String(), func() (interface{}, time.Duration) {
+		name := dnsCtx.lookup(ip)
+		//failed lookups are kept for negativeTTL
+		if name == "" {
+			return name, dnsCtx.negativeTTL
+		}
+		return name, dnsCtx.ttl
+	})
+	if hit {
+		ReverseDnsCacheHits.Inc()
+	} else {
+		ReverseDnsCacheMisses.Inc()
+	}
+	name := cached.(string)
+	if name == "" {
 		return nil, nil
 	}
-	//When using the host C library resolver, at most one result will be returned. To bypass the host resolver, use a custom Resolver.
-	ret["reverse_dns"] = rets[0]
-	return ret, nil
+	return map[string]string{"reverse_dns": name}, nil
+}
+
+//lookup returns the name of ip, or an empty string if there is none (or it isn't confirmed)
+func (c *DnsEnricherCtx) lookup(ip net.IP) string {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	names, err := c.resolver.LookupAddr(ctx, ip.String())
+	if err != nil || len(names) == 0 {
+		log.Debugf("failed to resolve '%s' : %v", ip, err)
+		return ""
+	}
+	if !c.forwardConfirm {
+		//When using the host C library resolver, at most one result will be returned. To bypass the host resolver, use a custom Resolver.
+		return names[0]
+	}
+	for _, name := range names {
+		addrs, err := c.resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			log.Debugf("failed to resolve '%s' : %v", name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(ip) {
+				return name
+			}
+		}
+	}
+	log.Debugf("no name of '%s' resolves back to it", ip)
+	return ""
 }
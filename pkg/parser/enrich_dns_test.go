@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+//stubDns is a dns server answering from static PTR and A records
+type stubDns struct {
+	conn    net.PacketConn
+	ptr     map[string]string //in-addr.arpa name -> name
+	a       map[string]net.IP
+	silent  map[string]bool //names the server never answers
+	lock    sync.Mutex
+	queries map[string]int
+}
+
+func newStubDns(t *testing.T) *stubDns {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen : %s", err)
+	}
+	s := &stubDns{
+		conn: conn,
+		ptr: map[string]string{
+			"4.3.2.1.in-addr.arpa.": "host.example.com.",
+			"8.7.6.5.in-addr.arpa.": "spoofed.example.com.",
+		},
+		a: map[string]net.IP{
+			"host.example.com.":    net.ParseIP("1.2.3.4"),
+			"spoofed.example.com.": net.ParseIP("9.9.9.9"),
+		},
+		silent:  map[string]bool{"2.0.0.10.in-addr.arpa.": true},
+		queries: make(map[string]int),
+	}
+	go s.serve()
+	return s
+}
+
+func (s *stubDns) count(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.queries[name]
+}
+
+func (s *stubDns) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) != 1 {
+			continue
+		}
+		q := msg.Questions[0]
+		name := q.Name.String()
+		s.lock.Lock()
+		s.queries[name]++
+		s.lock.Unlock()
+		if s.silent[name] {
+			continue
+		}
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: msg.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeNameError},
+			Questions: msg.Questions,
+		}
+		hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		switch q.Type {
+		case dnsmessage.TypePTR:
+			if target, ok := s.ptr[name]; ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(target)}})
+			}
+		case dnsmessage.TypeA:
+			if ip, ok := s.a[name]; ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+				var a [4]byte
+				copy(a[:], ip.To4())
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: a}})
+			}
+		default:
+			if _, ok := s.a[name]; ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+			}
+		}
+		out, err := resp.Pack()
+		if err != nil {
+			continue
+		}
+		s.conn.WriteTo(out, addr)
+	}
+}
+
+func TestDnsInit(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"resolver": "127.0.0.1"},
+		{"timeout": "ratata"},
+		{"forward_confirm": "ratata"},
+		{"cache_size": "-1"},
+		{"cache_ttl": "ratata"},
+		{"negative_cache_ttl": "ratata"},
+	} {
+		if _, err := DnsInit(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestReverseDns(t *testing.T) {
+	stub := newStubDns(t)
+	defer stub.conn.Close()
+
+	ctx, err := DnsInit(map[string]string{
+		"resolver":           stub.conn.LocalAddr().String(),
+		"timeout":            "200ms",
+		"forward_confirm":    "true",
+		"negative_cache_ttl": "300ms",
+	})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	for _, tc := range []struct {
+		ip       string
+		expected string
+	}{
+		{"1.2.3.4", "host.example.com."},
+		{"5.6.7.8", ""},  //doesn't resolve back to the ip
+		{"10.0.0.1", ""}, //NXDOMAIN
+		{"10.0.0.2", ""}, //timeout
+		{"not an ip", ""},
+	} {
+		ret, err := reverse_dns(tc.ip, nil, ctx)
+		if err != nil {
+			t.Fatalf("%s : unexpected error %s", tc.ip, err)
+		}
+		if ret["reverse_dns"] != tc.expected {
+			t.Fatalf("%s : expected '%s', got '%s'", tc.ip, tc.expected, ret["reverse_dns"])
+		}
+	}
+
+	//successful and failed lookups are cached
+	for _, ip := range []string{"1.2.3.4", "10.0.0.1", "10.0.0.2"} {
+		if _, err := reverse_dns(ip, nil, ctx); err != nil {
+			t.Fatalf("%s : unexpected error %s", ip, err)
+		}
+	}
+	if stub.count("4.3.2.1.in-addr.arpa.") != 1 {
+		t.Fatalf("expected 1 query for 1.2.3.4, got %d", stub.count("4.3.2.1.in-addr.arpa."))
+	}
+	nxdomain := stub.count("1.0.0.10.in-addr.arpa.")
+	if nxdomain == 0 {
+		t.Fatalf("expected a query for 10.0.0.1")
+	}
+	if _, err := reverse_dns("10.0.0.1", nil, ctx); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if stub.count("1.0.0.10.in-addr.arpa.") != nxdomain {
+		t.Fatalf("expected the failed lookup of 10.0.0.1 to be cached")
+	}
+	//until the negative ttl expires
+	time.Sleep(400 * time.Millisecond)
+	if _, err := reverse_dns("10.0.0.1", nil, ctx); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if stub.count("1.0.0.10.in-addr.arpa.") == nxdomain {
+		t.Fatalf("expected the failed lookup of 10.0.0.1 to expire")
+	}
+}
+
+func TestDnsCacheEviction(t *testing.T) {
+	ctx, err := DnsInit(map[string]string{"cache_size": "2"})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	dnsCtx := ctx.(*DnsEnricherCtx)
+	dnsCtx.cache.add("1.1.1.1", "one.", dnsCtx.ttl)
+	dnsCtx.cache.add("2.2.2.2", "two.", dnsCtx.ttl)
+	//1.1.1.1 is now the most recently used
+	if name, ok := dnsCtx.cache.get("1.1.1.1"); !ok || name.(string) != "one." {
+		t.Fatalf("expected 'one.', got '%v' (%t)", name, ok)
+	}
+	dnsCtx.cache.add("3.3.3.3", "", dnsCtx.negativeTTL)
+	if _, ok := dnsCtx.cache.get("2.2.2.2"); ok {
+		t.Fatalf("expected 2.2.2.2 to be evicted")
+	}
+	if name, ok := dnsCtx.cache.get("3.3.3.3"); !ok || name.(string) != "" {
+		t.Fatalf("expected a negative entry for 3.3.3.3, got '%v' (%t)", name, ok)
+	}
+	if _, ok := dnsCtx.cache.get("1.1.1.1"); !ok {
+		t.Fatalf("expected 1.1.1.1 to be kept")
+	}
+}
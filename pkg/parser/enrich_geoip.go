@@ -2,26 +2,76 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"gopkg.in/tomb.v2"
 
 	"github.com/oschwald/geoip2-golang"
 	"github.com/oschwald/maxminddb-golang"
-	//"github.com/crowdsecurity/crowdsec/pkg/parser"
 )
 
+const (
+	GeoIpCityFile = "GeoLite2-City.mmdb"
+	GeoIpASNFile  = "GeoLite2-ASN.mmdb"
+)
+
+//GeoIpReloadDelay is how long to wait after a database changed on disk before reloading it, so that it's fully written
+var GeoIpReloadDelay = 2 * time.Second
+
+//GeoIpCheckInterval is how often the databases are checked for changes, in case inotify missed something
+var GeoIpCheckInterval = time.Minute
+
+var GeoIpDatabaseInfo = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "cs_geoip_database_info",
+		Help: "The GeoIP databases, 1 if loaded, with their type and build date.",
+	},
+	[]string{"database", "type", "build_date"},
+)
+
+/*
+ GeoIpEnricherCtx holds the databases of the data directory, and reloads them when they change on disk.
+ A database that is missing or can't be loaded makes its methods return nothing.
+*/
 type GeoIpEnricherCtx struct {
-	dbc   *geoip2.Reader
-	dba   *geoip2.Reader
-	dbraw *maxminddb.Reader
+	datadir string
+	lock    sync.RWMutex
+	dbc     *geoip2.Reader
+	dba     *geoip2.Reader
+	dbraw   *maxminddb.Reader
+	loaded  map[string]os.FileInfo //the version of the files that are loaded
+	info    map[string]prometheus.Labels
+	watcher *fsnotify.Watcher //nil if inotify isn't available
+	//GeoIpReloadDelay and GeoIpCheckInterval at init
+	reloadDelay   time.Duration
+	checkInterval time.Duration
+	t             tomb.Tomb
 }
 
 /* All plugins must export a list of function pointers for exported symbols */
 var ExportedFuncs = []string{"GeoIpASN", "GeoIpCity"}
 
+func init() {
+	err := RegisterEnricher("geoip", GeoIpInit, map[string]EnrichFunc{
+		"GeoIpASN":  GeoIpASN,
+		"GeoIpCity": GeoIpCity,
+		"IpToRange": IpToRange,
+	})
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
 func IpToRange(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
 	var dummy interface{}
 	ret := make(map[string]string)
@@ -34,7 +84,13 @@ func IpToRange(field string, p *types.Event, ctx interface{}) (map[string]string
 		log.Infof("Can't parse ip %s, no range enrich", field)
 		return nil, nil
 	}
-	net, ok, err := ctx.(GeoIpEnricherCtx).dbraw.LookupNetwork(ip, &dummy)
+	geoCtx := ctx.(*GeoIpEnricherCtx)
+	geoCtx.lock.RLock()
+	defer geoCtx.lock.RUnlock()
+	if geoCtx.dbraw == nil {
+		return nil, nil
+	}
+	net, ok, err := geoCtx.dbraw.LookupNetwork(ip, &dummy)
 	if err != nil {
 		log.Errorf("Failed to fetch network for %s : %v", ip.String(), err)
 		return nil, nil
@@ -54,7 +110,17 @@ func GeoIpASN(field string, p *types.Event, ctx interface{}) (map[string]string,
 	}
 
 	ip := net.ParseIP(field)
-	record, err := ctx.(GeoIpEnricherCtx).dba.ASN(ip)
+	if ip == nil {
+		log.Debugf("Can't parse ip %s, no ASN enrich", field)
+		return nil, nil
+	}
+	geoCtx := ctx.(*GeoIpEnricherCtx)
+	geoCtx.lock.RLock()
+	defer geoCtx.lock.RUnlock()
+	if geoCtx.dba == nil {
+		return nil, nil
+	}
+	record, err := geoCtx.dba.ASN(ip)
 	if err != nil {
 		log.Debugf("Unable to enrich ip '%s'", field)
 		return nil, nil
@@ -71,10 +137,20 @@ func GeoIpCity(field string, p *types.Event, ctx interface{}) (map[string]string
 		return nil, nil
 	}
 	ip := net.ParseIP(field)
-	record, err := ctx.(GeoIpEnricherCtx).dbc.City(ip)
+	if ip == nil {
+		log.Debugf("Can't parse ip %s, no City enrich", field)
+		return nil, nil
+	}
+	geoCtx := ctx.(*GeoIpEnricherCtx)
+	geoCtx.lock.RLock()
+	defer geoCtx.lock.RUnlock()
+	if geoCtx.dbc == nil {
+		return nil, nil
+	}
+	record, err := geoCtx.dbc.City(ip)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		log.Debugf("Unable to enrich ip '%s' : %s", field, err)
+		return nil, nil
 	}
 	ret["IsoCode"] = record.Country.IsoCode
 	ret["IsInEU"] = strconv.FormatBool(record.Country.IsInEuropeanUnion)
@@ -88,24 +164,154 @@ func GeoIpCity(field string, p *types.Event, ctx interface{}) (map[string]string
 
 /* All plugins must export an Init function */
 func GeoIpInit(cfg map[string]string) (interface{}, error) {
-	var ctx GeoIpEnricherCtx
-	var err error
-	ctx.dbc, err = geoip2.Open(cfg["datadir"] + "/GeoLite2-City.mmdb")
-	if err != nil {
-		log.Debugf("couldn't open geoip : %v", err)
-		return nil, err
+	ctx := &GeoIpEnricherCtx{
+		datadir:       cfg["datadir"],
+		loaded:        make(map[string]os.FileInfo),
+		info:          make(map[string]prometheus.Labels),
+		reloadDelay:   GeoIpReloadDelay,
+		checkInterval: GeoIpCheckInterval,
 	}
-	ctx.dba, err = geoip2.Open(cfg["datadir"] + "/GeoLite2-ASN.mmdb")
-	if err != nil {
-		log.Debugf("couldn't open geoip : %v", err)
-		return nil, err
+	ctx.reload()
+	if ctx.dbc == nil && ctx.dba == nil {
+		log.Warningf("no geoip database in %s, geoip enrichment is disabled until they are available", ctx.datadir)
 	}
 
-	ctx.dbraw, err = maxminddb.Open(cfg["datadir"] + "/GeoLite2-ASN.mmdb")
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		log.Debugf("couldn't open geoip : %v", err)
-		return nil, err
+		log.Warningf("unable to watch %s, geoip databases are checked every %s : %s", ctx.datadir, GeoIpCheckInterval, err)
+	} else if err := watcher.Add(ctx.datadir); err != nil {
+		log.Warningf("unable to watch %s, geoip databases are checked every %s : %s", ctx.datadir, GeoIpCheckInterval, err)
+		watcher.Close()
+	} else {
+		ctx.watcher = watcher
 	}
-
+	ctx.t.Go(ctx.watch)
 	return ctx, nil
 }
+
+//watch reloads the databases when they change
+func (ctx *GeoIpEnricherCtx) watch() error {
+	var events chan fsnotify.Event
+	var watchErrors chan error
+
+	if ctx.watcher != nil {
+		defer ctx.watcher.Close()
+		events = ctx.watcher.Events
+		watchErrors = ctx.watcher.Errors
+	}
+	ticker := time.NewTicker(ctx.checkInterval)
+	defer ticker.Stop()
+	//the reload is delayed after the last change
+	delay := time.NewTimer(ctx.reloadDelay)
+	delay.Stop()
+	for {
+		select {
+		case <-ctx.t.Dying():
+			return nil
+		case evt := <-events:
+			name := filepath.Base(evt.Name)
+			if name == GeoIpCityFile || name == GeoIpASNFile {
+				delay.Reset(ctx.reloadDelay)
+			}
+		case err := <-watchErrors:
+			log.Warningf("while watching %s : %s", ctx.datadir, err)
+		case <-delay.C:
+			ctx.reload()
+		case <-ticker.C:
+			ctx.reload()
+		}
+	}
+}
+
+//reload loads the databases that changed since they were loaded. A database that fails to load is kept in its previous version
+func (ctx *GeoIpEnricherCtx) reload() {
+	for _, file := range []string{GeoIpCityFile, GeoIpASNFile} {
+		path := filepath.Join(ctx.datadir, file)
+		stat, err := os.Stat(path)
+		if err != nil {
+			if _, ok := ctx.loaded[file]; !ok {
+				log.Debugf("couldn't open geoip : %v", err)
+				ctx.setInfo(file, prometheus.Labels{"database": file, "type": "", "build_date": ""}, 0)
+			}
+			continue
+		}
+		if prev, ok := ctx.loaded[file]; ok && prev.ModTime().Equal(stat.ModTime()) && prev.Size() == stat.Size() {
+			continue
+		}
+		//the database is read in memory rather than mapped, so that it can't change under our feet
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Warningf("couldn't read geoip database %s, keeping the previous one : %v", path, err)
+			continue
+		}
+		reader, err := geoip2.FromBytes(data)
+		if err != nil {
+			log.Warningf("couldn't load geoip database %s, keeping the previous one : %v", path, err)
+			continue
+		}
+		var raw *maxminddb.Reader
+		if file == GeoIpASNFile {
+			if raw, err = maxminddb.FromBytes(data); err != nil {
+				log.Warningf("couldn't load geoip database %s, keeping the previous one : %v", path, err)
+				continue
+			}
+		}
+
+		ctx.lock.Lock()
+		var old []interface{ Close() error }
+		if file == GeoIpCityFile {
+			if ctx.dbc != nil {
+				old = append(old, ctx.dbc)
+			}
+			ctx.dbc = reader
+		} else {
+			if ctx.dba != nil {
+				old = append(old, ctx.dba, ctx.dbraw)
+			}
+			ctx.dba, ctx.dbraw = reader, raw
+		}
+		ctx.lock.Unlock()
+		for _, db := range old {
+			if err := db.Close(); err != nil {
+				log.Warningf("while closing the previous %s : %s", path, err)
+			}
+		}
+
+		ctx.loaded[file] = stat
+		meta := reader.Metadata()
+		info := prometheus.Labels{
+			"database":   file,
+			"type":       meta.DatabaseType,
+			"build_date": time.Unix(int64(meta.BuildEpoch), 0).UTC().Format(time.RFC3339),
+		}
+		ctx.setInfo(file, info, 1)
+		log.Infof("loaded geoip database %s (%s, built %s)", path, info["type"], info["build_date"])
+	}
+}
+
+func (ctx *GeoIpEnricherCtx) setInfo(file string, info prometheus.Labels, value float64) {
+	if prev, ok := ctx.info[file]; ok {
+		GeoIpDatabaseInfo.Delete(prev)
+	}
+	ctx.info[file] = info
+	GeoIpDatabaseInfo.With(info).Set(value)
+}
+
+//Close stops watching the databases and closes them
+func (ctx *GeoIpEnricherCtx) Close() error {
+	ctx.t.Kill(nil)
+	if err := ctx.t.Wait(); err != nil {
+		return err
+	}
+	ctx.lock.Lock()
+	defer ctx.lock.Unlock()
+	if ctx.dbc != nil {
+		ctx.dbc.Close()
+	}
+	if ctx.dba != nil {
+		ctx.dba.Close()
+		ctx.dbraw.Close()
+	}
+	ctx.dbc, ctx.dba, ctx.dbraw = nil, nil, nil
+	return nil
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+ a minimal MaxMind DB writer : the search tree has a single node, so that all
+ the ipv4 addresses starting with a 0 bit (0.0.0.0/1) map to the data record.
+*/
+func mmdbControl(kind byte, size int) []byte {
+	if kind > 7 {
+		return []byte{byte(size), kind - 7}
+	}
+	return []byte{kind<<5 | byte(size)}
+}
+
+func mmdbString(s string) []byte {
+	if len(s) < 29 {
+		return append(mmdbControl(2, len(s)), s...)
+	}
+	return append(append(mmdbControl(2, 29), byte(len(s)-29)), s...)
+}
+
+func mmdbUint(kind byte, size int, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return append(mmdbControl(kind, size), buf[8-size:]...)
+}
+
+func mmdbDouble(v float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(v))
+	return append(mmdbControl(3, 8), buf...)
+}
+
+func mmdbBool(v bool) []byte {
+	if v {
+		return mmdbControl(14, 1)
+	}
+	return mmdbControl(14, 0)
+}
+
+//mmdbMap encodes a map, kv alternates the keys and their encoded values
+func mmdbMap(kv ...interface{}) []byte {
+	ret := mmdbControl(7, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		ret = append(ret, mmdbString(kv[i].(string))...)
+		ret = append(ret, kv[i+1].([]byte)...)
+	}
+	return ret
+}
+
+func writeTestMmdb(t *testing.T, path string, dbType string, buildEpoch uint64, data []byte) {
+	var buf bytes.Buffer
+
+	//one node of two 24 bits records : the left one points to the data, the right one is empty (== node count)
+	buf.Write([]byte{0, 0, 17, 0, 0, 1})
+	buf.Write(make([]byte, 16))
+	buf.Write(data)
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	buf.Write(mmdbMap(
+		"node_count", mmdbUint(6, 4, 1),
+		"record_size", mmdbUint(5, 2, 24),
+		"ip_version", mmdbUint(5, 2, 4),
+		"database_type", mmdbString(dbType),
+		"binary_format_major_version", mmdbUint(5, 2, 2),
+		"binary_format_minor_version", mmdbUint(5, 2, 0),
+		"build_epoch", mmdbUint(9, 8, buildEpoch),
+	))
+	//write and rename, as database updaters do
+	if err := ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		t.Fatalf("unable to write %s : %s", path, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatalf("unable to write %s : %s", path, err)
+	}
+}
+
+func writeTestASN(t *testing.T, dir string, asn uint64, org string, buildEpoch uint64) {
+	writeTestMmdb(t, filepath.Join(dir, GeoIpASNFile), "GeoLite2-ASN", buildEpoch, mmdbMap(
+		"autonomous_system_number", mmdbUint(6, 4, asn),
+		"autonomous_system_organization", mmdbString(org),
+	))
+}
+
+func TestGeoIpReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geoip")
+	if err != nil {
+		t.Fatalf("unable to create temp dir : %s", err)
+	}
+	defer os.RemoveAll(dir)
+	oldDelay := GeoIpReloadDelay
+	GeoIpReloadDelay = 50 * time.Millisecond
+	defer func() { GeoIpReloadDelay = oldDelay }()
+
+	//no database yet : no enrichment, but no error either
+	ctx, err := GeoIpInit(map[string]string{"datadir": dir})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	geoCtx := ctx.(*GeoIpEnricherCtx)
+	defer geoCtx.Close()
+	for _, method := range []EnrichFunc{GeoIpASN, GeoIpCity, IpToRange} {
+		ret, err := method("1.2.3.4", nil, ctx)
+		if err != nil || len(ret) != 0 {
+			t.Fatalf("expected no enrichment, got %+v (%v)", ret, err)
+		}
+	}
+
+	//the databases are loaded as they appear
+	writeTestASN(t, dir, 64512, "First Org", 1600000000)
+	writeTestMmdb(t, filepath.Join(dir, GeoIpCityFile), "GeoLite2-City", 1600000000, mmdbMap(
+		"country", mmdbMap("iso_code", mmdbString("FR"), "is_in_european_union", mmdbBool(true)),
+		"location", mmdbMap("latitude", mmdbDouble(1.5), "longitude", mmdbDouble(2.5)),
+	))
+	expectEnrich(t, GeoIpASN, ctx, "1.2.3.4", map[string]string{"ASNNumber": "64512", "ASNOrg": "First Org"})
+	expectEnrich(t, GeoIpCity, ctx, "1.2.3.4", map[string]string{"IsoCode": "FR", "IsInEU": "true", "Latitude": "1.500000", "Longitude": "2.500000"})
+	expectEnrich(t, IpToRange, ctx, "1.2.3.4", map[string]string{"SourceRange": "0.0.0.0/1"})
+	//outside of the database
+	if ret, err := GeoIpCity("200.1.2.3", nil, ctx); err != nil || ret["IsoCode"] != "" {
+		t.Fatalf("expected no country, got %+v (%v)", ret, err)
+	}
+
+	//an update is picked up
+	writeTestASN(t, dir, 64513, "Second Org", 1700000000)
+	expectEnrich(t, GeoIpASN, ctx, "1.2.3.4", map[string]string{"ASNNumber": "64513", "ASNOrg": "Second Org"})
+
+	//a broken update is ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, GeoIpASNFile), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("unable to write : %s", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	expectEnrich(t, GeoIpASN, ctx, "1.2.3.4", map[string]string{"ASNNumber": "64513", "ASNOrg": "Second Org"})
+
+	if err := geoCtx.Close(); err != nil {
+		t.Fatalf("unable to close : %s", err)
+	}
+	info := geoCtx.info[GeoIpASNFile]
+	if info["type"] != "GeoLite2-ASN" || info["build_date"] != "2023-11-14T22:13:20Z" {
+		t.Fatalf("unexpected database info %+v", info)
+	}
+}
+
+//expectEnrich waits for the enrichment of ip to be the expected one
+func expectEnrich(t *testing.T, method EnrichFunc, ctx interface{}, ip string, expected map[string]string) {
+	var ret map[string]string
+	var err error
+
+	for i := 0; i < 50; i++ {
+		ret, err = method(ip, nil, ctx)
+		if err != nil {
+			t.Fatalf("unexpected error : %s", err)
+		}
+		ok := len(ret) == len(expected)
+		for k, v := range expected {
+			if ret[k] != v {
+				ok = false
+			}
+		}
+		if ok {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("expected %+v, got %+v", expected, ret)
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/crowdsecurity/crowdsec/pkg/exprhelpers"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+//IPListsEnricherCtx holds the ranges of all the lists in a single tree, tagged with the name of their list
+type IPListsEnricherCtx struct {
+	tree  *exprhelpers.IPTree
+	names []string
+}
+
+func init() {
+	if err := RegisterEnricher("iplists", IPListsInit, map[string]EnrichFunc{"IpInLists": IpInLists}); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+/*
+ IPListsInit loads the ip lists. Each setting (but datadir) is a list : its name, and the file of ips
+ and ranges (one per line), relative to the data directory. A list whose file is missing is empty.
+*/
+func IPListsInit(cfg map[string]string) (interface{}, error) {
+	ctx := &IPListsEnricherCtx{tree: exprhelpers.NewIPTree()}
+	for name, file := range cfg {
+		if name == "datadir" {
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, ", ") {
+			return nil, fmt.Errorf("invalid list name '%s'", name)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(cfg["datadir"], file)
+		}
+		fd, err := os.Open(file)
+		if os.IsNotExist(err) {
+			log.Warningf("ip list %s : %s doesn't exist, the list is empty", name, file)
+			ctx.names = append(ctx.names, name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ip list %s : %s", name, err)
+		}
+		before := ctx.tree.Len()
+		invalid, err := ctx.tree.Load(fd, name)
+		fd.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ip list %s : while reading %s : %s", name, file, err)
+		}
+		if invalid > 0 {
+			log.Warningf("ip list %s : %d invalid ips or ranges ignored in %s", name, invalid, file)
+		}
+		log.Infof("loaded ip list %s from %s (%d ranges)", name, file, ctx.tree.Len()-before)
+		ctx.names = append(ctx.names, name)
+	}
+	sort.Strings(ctx.names)
+	return ctx, nil
+}
+
+/*
+ IpInLists tells in which lists the ip is : IpLists is the sorted, comma-separated, names of the lists,
+ and IpList_<name> is set to true for each of them.
+*/
+func IpInLists(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
+	if field == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(field)
+	if ip == nil {
+		log.Debugf("can't parse ip '%s', no ip lists enrich", field)
+		return nil, nil
+	}
+	names := ctx.(*IPListsEnricherCtx).tree.Lookup(ip)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+	ret := map[string]string{"IpLists": strings.Join(names, ",")}
+	for _, name := range names {
+		ret["IpList_"+name] = "true"
+	}
+	return ret, nil
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIpInLists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iplists")
+	if err != nil {
+		t.Fatalf("unable to create temp dir : %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "tor.txt"), []byte("# tor exit nodes\n1.2.3.4\n5.6.7.8\n"), 0644); err != nil {
+		t.Fatalf("unable to write : %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "vpn.txt"), []byte("1.2.0.0/16\n2001:db8::/32\n"), 0644); err != nil {
+		t.Fatalf("unable to write : %s", err)
+	}
+
+	ctx, err := IPListsInit(map[string]string{
+		"datadir":  dir,
+		"tor":      "tor.txt",
+		"vpn":      filepath.Join(dir, "vpn.txt"),
+		"scanners": "scanners.txt", //missing
+	})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	for _, tc := range []struct {
+		ip       string
+		expected map[string]string
+	}{
+		{"1.2.3.4", map[string]string{"IpLists": "tor,vpn", "IpList_tor": "true", "IpList_vpn": "true"}},
+		{"1.2.200.1", map[string]string{"IpLists": "vpn", "IpList_vpn": "true"}},
+		{"5.6.7.8", map[string]string{"IpLists": "tor", "IpList_tor": "true"}},
+		{"2001:db8::1", map[string]string{"IpLists": "vpn", "IpList_vpn": "true"}},
+		{"8.8.8.8", map[string]string{}},
+		{"not an ip", map[string]string{}},
+		{"", map[string]string{}},
+	} {
+		ret, err := IpInLists(tc.ip, nil, ctx)
+		if err != nil {
+			t.Fatalf("%s : unexpected error %s", tc.ip, err)
+		}
+		if len(ret) != len(tc.expected) {
+			t.Fatalf("%s : expected %+v, got %+v", tc.ip, tc.expected, ret)
+		}
+		for k, v := range tc.expected {
+			if ret[k] != v {
+				t.Fatalf("%s : expected %+v, got %+v", tc.ip, tc.expected, ret)
+			}
+		}
+	}
+
+	if _, err := IPListsInit(map[string]string{"datadir": dir, "tor,vpn": "tor.txt"}); err == nil {
+		t.Fatalf("expected error for an invalid list name")
+	}
+}
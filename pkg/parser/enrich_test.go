@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+)
+
+func echoEnrich(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
+	return map[string]string{"echo": ctx.(string) + field}, nil
+}
+
+func failEnrich(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
+	return nil, fmt.Errorf("asked to fail on '%s'", field)
+}
+
+func echoInit(cfg map[string]string) (interface{}, error) {
+	if cfg["fail"] != "" {
+		return nil, fmt.Errorf("asked to fail")
+	}
+	return cfg["prefix"], nil
+}
+
+func registerTestEnrichers(t *testing.T) func() {
+	oldECTX := ECTX
+	for _, name := range []string{"testecho", "testecho2", "testfail"} {
+		if err := RegisterEnricher(name, echoInit, map[string]EnrichFunc{"Echo": echoEnrich, name + "Only": echoEnrich, "Fail": failEnrich}); err != nil {
+			t.Fatalf("failed to register %s : %s", name, err)
+		}
+	}
+	return func() {
+		ECTX = oldECTX
+		delete(registeredEnrichers, "testecho")
+		delete(registeredEnrichers, "testecho2")
+		delete(registeredEnrichers, "testfail")
+	}
+}
+
+func TestRegisterEnricher(t *testing.T) {
+	if err := RegisterEnricher("geoip", nil, nil); err == nil {
+		t.Fatalf("expected error on duplicate enricher")
+	}
+	if err := RegisterEnricher("bad.name", nil, nil); err == nil {
+		t.Fatalf("expected error on invalid name")
+	}
+}
+
+func TestLoadEnrichers(t *testing.T) {
+	var err error
+
+	defer registerTestEnrichers(t)()
+
+	if _, err := LoadEnrichers(csconfig.EnrichersConfig{Enrichers: map[string]csconfig.EnricherConfig{"ratata": {}}}, "../../data/"); err == nil {
+		t.Fatalf("expected error on unknown enricher")
+	}
+	cfg := csconfig.EnrichersConfig{Enrichers: map[string]csconfig.EnricherConfig{
+		"testecho":  {Config: map[string]string{"prefix": "hello "}},
+		"testecho2": {Disabled: true},
+		"testfail":  {Config: map[string]string{"fail": "true"}},
+	}}
+	ECTX, err = LoadEnrichers(cfg, "../../data/")
+	if err != nil {
+		t.Fatalf("failed to load enrichers : %s", err)
+	}
+	status := make(map[string]error)
+	for _, c := range ECTX {
+		status[c.Name] = c.Status
+	}
+	if status["testecho"] != nil || status["testecho2"] != ErrEnricherDisabled || status["testfail"] == nil || status["date"] != nil {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	enricher, fptr, err := findMethod("testecho.Echo")
+	if err != nil {
+		t.Fatalf("failed to find method : %s", err)
+	}
+	ret, err := fptr("world", nil, enricher.RuntimeCtx)
+	if err != nil || ret["echo"] != "hello world" {
+		t.Fatalf("unexpected result %+v (%v)", ret, err)
+	}
+	for method, expectErr := range map[string]bool{
+		"testechoOnly":     false,
+		"ParseDate":        false,
+		"Echo":             true, //ambiguous
+		"testecho.Ratata":  true,
+		"ratata.Echo":      true,
+		"RatataUnknownFun": true,
+	} {
+		if _, _, err := findMethod(method); (err != nil) != expectErr {
+			t.Fatalf("%s : expected error %t, got %v", method, expectErr, err)
+		}
+	}
+
+	for idx, tc := range []struct {
+		method string
+		valid  bool
+	}{
+		{"testecho.Echo", true},
+		{"testfail.Echo", true}, //skipped at runtime
+		{"testecho2.Echo", false},
+		{"Echo", false},
+		{"Ratata", false},
+	} {
+		node := Node{Name: "test", Stage: "s00-raw", Statics: []types.ExtraField{{Method: tc.method, ExpValue: "evt.Parsed.foo"}}}
+		if err := node.validate(&UnixParserCtx{}); (err == nil) != tc.valid {
+			t.Fatalf("%d : %s, expected valid %t, got %v", idx, tc.method, tc.valid, err)
+		}
+	}
+
+	//a method returning an error doesn't prevent the other statics
+	evt := types.Event{Parsed: map[string]string{"foo": "world"}, Enriched: map[string]string{}, Meta: map[string]string{}}
+	statics := []types.ExtraField{{Method: "testecho.Fail", Value: "world"}, {Method: "testecho.Echo", Value: "world"}}
+	before := testutil.ToFloat64(EnricherErrors.With(prometheus.Labels{"name": "testecho"}))
+	if err := ProcessStatics(statics, &evt, log.WithField("test", "fail")); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if evt.Enriched["echo"] != "hello world" {
+		t.Fatalf("unexpected enrichment %+v", evt.Enriched)
+	}
+	if testutil.ToFloat64(EnricherErrors.With(prometheus.Labels{"name": "testecho"})) != before+1 {
+		t.Fatalf("expected the error to be counted")
+	}
+}
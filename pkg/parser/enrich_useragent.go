@@ -0,0 +1,252 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+//UserAgentFile is the regexes file of the useragent enricher in the data directory, in the ua-parser format
+const UserAgentFile = "ua_regexes.yaml"
+
+//the operating systems that tell the device type when the device itself doesn't
+var (
+	mobileOS  = map[string]bool{"iOS": true, "Android": true, "Windows Phone": true, "BlackBerry OS": true}
+	desktopOS = map[string]bool{"Windows": true, "Mac OS X": true, "Chrome OS": true, "Linux": true, "Ubuntu": true,
+		"Debian": true, "Fedora": true, "CentOS": true, "Red Hat": true, "SUSE": true, "Arch Linux": true, "Linux Mint": true,
+		"FreeBSD": true, "OpenBSD": true, "NetBSD": true}
+)
+
+//uaRegex is an entry of the ua-parser regexes file. The replacements can refer to the groups of the regex ($1 to $9)
+type uaRegex struct {
+	Regex     string `yaml:"regex"`
+	RegexFlag string `yaml:"regex_flag"`
+	//user_agent_parsers
+	Family string `yaml:"family_replacement"`
+	V1     string `yaml:"v1_replacement"`
+	V2     string `yaml:"v2_replacement"`
+	V3     string `yaml:"v3_replacement"`
+	//os_parsers
+	OS   string `yaml:"os_replacement"`
+	OSV1 string `yaml:"os_v1_replacement"`
+	OSV2 string `yaml:"os_v2_replacement"`
+	OSV3 string `yaml:"os_v3_replacement"`
+	OSV4 string `yaml:"os_v4_replacement"`
+	//device_parsers
+	Device string `yaml:"device_replacement"`
+	Brand  string `yaml:"brand_replacement"`
+	Model  string `yaml:"model_replacement"`
+
+	re *regexp.Regexp
+}
+
+type uaRegexes struct {
+	UserAgent []*uaRegex `yaml:"user_agent_parsers"`
+	OS        []*uaRegex `yaml:"os_parsers"`
+	Device    []*uaRegex `yaml:"device_parsers"`
+}
+
+type UserAgentEnricherCtx struct {
+	regexes *uaRegexes
+	cache   *lruCache
+}
+
+func init() {
+	if err := RegisterEnricher("useragent", UserAgentInit, map[string]EnrichFunc{"ParseUserAgent": ParseUserAgent}); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+//loadUserAgentRegexes parses a ua-parser regexes file. The regexes that aren't supported by go are skipped
+func loadUserAgentRegexes(data []byte) (*uaRegexes, error) {
+	ret := &uaRegexes{}
+	if err := yaml.Unmarshal(data, ret); err != nil {
+		return nil, err
+	}
+	if len(ret.UserAgent) == 0 && len(ret.OS) == 0 && len(ret.Device) == 0 {
+		return nil, fmt.Errorf("no parsers found")
+	}
+	skipped := 0
+	for _, list := range []*[]*uaRegex{&ret.UserAgent, &ret.OS, &ret.Device} {
+		compiled := (*list)[:0]
+		for _, r := range *list {
+			expr := r.Regex
+			if r.RegexFlag == "i" {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				log.Debugf("skipping user agent regex '%s' : %s", r.Regex, err)
+				skipped++
+				continue
+			}
+			r.re = re
+			compiled = append(compiled, r)
+		}
+		*list = compiled
+	}
+	if skipped > 0 {
+		log.Warningf("%d user agent regexes aren't supported and are skipped", skipped)
+	}
+	return ret, nil
+}
+
+/*
+ UserAgentInit loads the regexes of the useragent enricher. All the settings are optional :
+  - file : the ua-parser regexes file, relative to the data directory (default ua_regexes.yaml).
+    The regexes bundled with crowdsec are used when it's missing or can't be loaded.
+  - cache_size : how many user agents are cached (default 1000)
+*/
+func UserAgentInit(cfg map[string]string) (interface{}, error) {
+	var err error
+
+	ctx := &UserAgentEnricherCtx{}
+	size := 1000
+	if cfg["cache_size"] != "" {
+		if size, err = strconv.Atoi(cfg["cache_size"]); err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid cache_size '%s'", cfg["cache_size"])
+		}
+	}
+	ctx.cache = newLruCache(size)
+
+	file := cfg["file"]
+	if file == "" {
+		file = UserAgentFile
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(cfg["datadir"], file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		if ctx.regexes, err = loadUserAgentRegexes(data); err != nil {
+			log.Warningf("unable to load user agent regexes from %s, using the bundled ones : %s", file, err)
+		} else {
+			log.Infof("loaded user agent regexes from %s", file)
+		}
+	} else if os.IsNotExist(err) {
+		log.Debugf("%s doesn't exist, using the bundled user agent regexes", file)
+	} else {
+		log.Warningf("unable to read user agent regexes from %s, using the bundled ones : %s", file, err)
+	}
+	if ctx.regexes == nil {
+		if ctx.regexes, err = loadUserAgentRegexes([]byte(defaultUserAgentRegexes)); err != nil {
+			return nil, fmt.Errorf("while loading the bundled user agent regexes : %s", err)
+		}
+	}
+	return ctx, nil
+}
+
+//replace returns the replacement with the groups of the match substituted, or the group idx if there is no replacement (nothing if idx is -1)
+func (r *uaRegex) replace(replacement string, match []string, idx int) string {
+	if replacement == "" {
+		if idx > 0 && idx < len(match) {
+			return strings.TrimSpace(match[idx])
+		}
+		return ""
+	}
+	for i := 9; i > 0; i-- {
+		group := ""
+		if i < len(match) {
+			group = match[i]
+		}
+		replacement = strings.Replace(replacement, "$"+strconv.Itoa(i), group, -1)
+	}
+	return strings.TrimSpace(replacement)
+}
+
+//joinVersion joins the parts of a version up to the first missing one
+func joinVersion(parts ...string) string {
+	var ret []string
+	for _, part := range parts {
+		if part == "" {
+			break
+		}
+		ret = append(ret, part)
+	}
+	return strings.Join(ret, ".")
+}
+
+func (ctx *UserAgentEnricherCtx) parse(ua string) map[string]string {
+	ret := map[string]string{
+		"UABrowser":        "Other",
+		"UABrowserVersion": "",
+		"UAOS":             "Other",
+		"UAOSVersion":      "",
+		"UADevice":         "Other",
+		"UADeviceBrand":    "",
+	}
+	for _, r := range ctx.regexes.UserAgent {
+		match := r.re.FindStringSubmatch(ua)
+		if match == nil {
+			continue
+		}
+		if family := r.replace(r.Family, match, 1); family != "" {
+			ret["UABrowser"] = family
+		}
+		ret["UABrowserVersion"] = joinVersion(r.replace(r.V1, match, 2), r.replace(r.V2, match, 3), r.replace(r.V3, match, 4))
+		break
+	}
+	for _, r := range ctx.regexes.OS {
+		match := r.re.FindStringSubmatch(ua)
+		if match == nil {
+			continue
+		}
+		if name := r.replace(r.OS, match, 1); name != "" {
+			ret["UAOS"] = name
+		}
+		ret["UAOSVersion"] = joinVersion(r.replace(r.OSV1, match, 2), r.replace(r.OSV2, match, 3),
+			r.replace(r.OSV3, match, 4), r.replace(r.OSV4, match, 5))
+		break
+	}
+	model := ""
+	for _, r := range ctx.regexes.Device {
+		match := r.re.FindStringSubmatch(ua)
+		if match == nil {
+			continue
+		}
+		if device := r.replace(r.Device, match, 1); device != "" {
+			ret["UADevice"] = device
+		}
+		ret["UADeviceBrand"] = r.replace(r.Brand, match, -1)
+		model = r.replace(r.Model, match, 1)
+		break
+	}
+
+	switch {
+	case ret["UADevice"] == "Spider":
+		ret["UADeviceType"] = "bot"
+	case ret["UADevice"] == "iPad" || model == "Tablet" || (ret["UAOS"] == "Android" && !strings.Contains(ua, "Mobile")):
+		ret["UADeviceType"] = "tablet"
+	case mobileOS[ret["UAOS"]] || model == "Smartphone":
+		ret["UADeviceType"] = "mobile"
+	case desktopOS[ret["UAOS"]]:
+		ret["UADeviceType"] = "desktop"
+	default:
+		ret["UADeviceType"] = "other"
+	}
+	ret["UAIsBot"] = strconv.FormatBool(ret["UADeviceType"] == "bot")
+	return ret
+}
+
+//ParseUserAgent parses a user agent into its browser, operating system and device
+func ParseUserAgent(field string, p *types.Event, ctx interface{}) (map[string]string, error) {
+	if field == "" {
+		return nil, nil
+	}
+	uaCtx := ctx.(*UserAgentEnricherCtx)
+	if cached, ok := uaCtx.cache.get(field); ok {
+		return cached.(map[string]string), nil
+	}
+	ret := uaCtx.parse(field)
+	uaCtx.cache.add(field, ret, 0)
+	log.Tracef("user agent '%s' -> %s %s, %s", field, ret["UABrowser"], ret["UABrowserVersion"], ret["UAOS"])
+	return ret, nil
+}
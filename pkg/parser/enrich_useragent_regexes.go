@@ -0,0 +1,149 @@
+package parser
+
+/*
+ defaultUserAgentRegexes is used by the useragent enricher when there is no regexes file in the data directory.
+ It's a subset of the ua-parser regexes (https://github.com/ua-parser/uap-core), in the same format,
+ focused on the browsers, crawlers and scanners seen in web server logs. The parsers are tried in order :
+ the first group is the family, and the next ones the version, unless replaced.
+*/
+const defaultUserAgentRegexes = `
+user_agent_parsers:
+  #scanners and http tools
+  - regex: '(sqlmap|nikto|Nikto|Nmap|masscan|zgrab|Nuclei|WPScan|DirBuster|gobuster|Acunetix|Netsparker|ZmEu|Wfuzz|Arachni|Nessus|OpenVAS|w3af|Go-http-client|python-requests|Python-urllib|aiohttp|curl|Wget|libwww-perl|Apache-HttpClient|okhttp|Java|PostmanRuntime|HTTPie|Scrapy|Mechanize)(?:/(\d+)(?:\.(\d+))?(?:\.(\d+))?)?'
+  - regex: '(Nmap Scripting Engine)'
+    family_replacement: 'Nmap'
+  #search engines and crawlers
+  - regex: '(Googlebot|Googlebot-Image|Googlebot-News|Googlebot-Video|AdsBot-Google|Mediapartners-Google|APIs-Google|Google-InspectionTool|bingbot|BingPreview|Slurp|DuckDuckBot|Baiduspider|YandexBot|YandexImages|Sogou web spider|Exabot|facebookexternalhit|facebookcatalog|Twitterbot|LinkedInBot|Pinterestbot|Applebot|AhrefsBot|SemrushBot|MJ12bot|DotBot|PetalBot|SeznamBot|CCBot|GPTBot|ClaudeBot|Bytespider|DataForSeoBot|BLEXBot|MegaIndex|Qwantify|archive\.org_bot|ia_archiver|UptimeRobot|Pingdom\.com_bot|Discordbot|TelegramBot|Slackbot|WhatsApp|redditbot|Amazonbot|coccocbot|Mail\.RU_Bot|SiteAuditBot|serpstatbot|Barkrowler|Censys|CensysInspect|Expanse|InternetMeasurement|NetcraftSurveyAgent)(?:[/ -](\d+)(?:\.(\d+))?(?:\.(\d+))?)?'
+  - regex: '(?i)([a-z0-9\-_\.]*(?:bot|crawler|spider|scanner|scraper|crawl))(?:[/ ](\d+)(?:\.(\d+))?(?:\.(\d+))?)?'
+  #browsers, the most specific first as they all pretend to be Mozilla, Safari or Chrome
+  - regex: '(Edge|EdgA|EdgiOS|Edg)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Edge'
+  - regex: '(OPR|OPiOS|Opera Mini|Opera Mobi)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Opera'
+  - regex: '(Opera)/.+Version/(\d+)\.(\d+)'
+    family_replacement: 'Opera'
+  - regex: '(Vivaldi)/(\d+)\.(\d+)(?:\.(\d+))?'
+  - regex: '(YaBrowser)/(\d+)\.(\d+)(?:\.(\d+))?'
+    family_replacement: 'Yandex Browser'
+  - regex: '(SamsungBrowser)/(\d+)\.(\d+)'
+    family_replacement: 'Samsung Internet'
+  - regex: '(UCBrowser)/(\d+)\.(\d+)(?:\.(\d+))?'
+  - regex: '(Brave)/(\d+)\.(\d+)(?:\.(\d+))?'
+  - regex: '(FxiOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Firefox iOS'
+  - regex: '(CriOS)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+    family_replacement: 'Chrome Mobile iOS'
+  - regex: '(HeadlessChrome)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(Chromium)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '; wv\).+(Chrome)/(\d+)\.(\d+)\.(\d+)'
+    family_replacement: 'Chrome Mobile WebView'
+  - regex: '(Chrome)/(\d+)\.(\d+)\.(\d+).* Mobile'
+    family_replacement: 'Chrome Mobile'
+  - regex: '(Chrome)/(\d+)\.(\d+)\.(\d+)'
+  - regex: '(Firefox)/(\d+)\.(\d+)(?:\.(\d+))?.*Mobile'
+    family_replacement: 'Firefox Mobile'
+  - regex: '(Firefox)/(\d+)(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(Version)/(\d+)\.(\d+)(?:\.(\d+))?.*Mobile/\S+ Safari'
+    family_replacement: 'Mobile Safari'
+  - regex: '(iPhone|iPad|iPod).*AppleWebKit'
+    family_replacement: 'Mobile Safari UI/WKWebView'
+  - regex: '(Version)/(\d+)\.(\d+)(?:\.(\d+))?.*Safari/'
+    family_replacement: 'Safari'
+  - regex: '(Trident)/7\.0.*rv:(\d+)\.(\d+)'
+    family_replacement: 'IE'
+  - regex: '(MSIE) (\d+)\.(\d+)'
+    family_replacement: 'IE'
+
+os_parsers:
+  - regex: '(Windows Phone)(?: OS)? (\d+)\.(\d+)'
+  - regex: '(Windows NT 10\.0)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '10'
+  - regex: '(Windows NT 6\.3)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '8.1'
+  - regex: '(Windows NT 6\.2)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '8'
+  - regex: '(Windows NT 6\.1)'
+    os_replacement: 'Windows'
+    os_v1_replacement: '7'
+  - regex: '(Windows NT 6\.0)'
+    os_replacement: 'Windows'
+    os_v1_replacement: 'Vista'
+  - regex: '(Windows NT 5\.[12])'
+    os_replacement: 'Windows'
+    os_v1_replacement: 'XP'
+  - regex: '(Windows)'
+  - regex: '(?:CPU OS|iPhone OS|CPU iPhone OS) (\d+)_(\d+)(?:_(\d+))?'
+    os_replacement: 'iOS'
+    os_v1_replacement: '$1'
+    os_v2_replacement: '$2'
+    os_v3_replacement: '$3'
+  - regex: '(iPhone|iPad|iPod)'
+    os_replacement: 'iOS'
+  - regex: '(Android)[ /-]?(\d+)?(?:\.(\d+))?(?:\.(\d+))?'
+  - regex: '(CrOS) \S+ (\d+)\.(\d+)\.(\d+)'
+    os_replacement: 'Chrome OS'
+  - regex: '(Mac OS X) (\d+)[_.](\d+)(?:[_.](\d+))?'
+  - regex: '(Macintosh)'
+    os_replacement: 'Mac OS X'
+  - regex: '(Ubuntu|Debian|Fedora|CentOS|Red Hat|SUSE|Arch Linux|Linux Mint)'
+  - regex: '(FreeBSD|OpenBSD|NetBSD)'
+  - regex: '(Linux)'
+  - regex: '(BlackBerry|BB10)'
+    os_replacement: 'BlackBerry OS'
+
+device_parsers:
+  #bots and scanners
+  - regex: '(?i)(bot|crawler|spider|scanner|scraper|crawl|slurp|facebookexternalhit|facebookcatalog|ia_archiver|WhatsApp|Pingdom|Censys|Expanse|InternetMeasurement|NetcraftSurveyAgent|HeadlessChrome)'
+    device_replacement: 'Spider'
+    brand_replacement: 'Spider'
+    model_replacement: 'Desktop'
+  - regex: '(sqlmap|nikto|Nikto|Nmap|masscan|zgrab|Nuclei|WPScan|DirBuster|gobuster|Acunetix|Netsparker|ZmEu|Wfuzz|Arachni|Nessus|OpenVAS|w3af|Go-http-client|python-requests|Python-urllib|aiohttp|curl|Wget|libwww-perl|Apache-HttpClient|okhttp|Java/|PostmanRuntime|HTTPie|Scrapy|Mechanize)'
+    device_replacement: 'Spider'
+    brand_replacement: 'Spider'
+    model_replacement: 'Desktop'
+  #apple
+  - regex: '(iPad)'
+    device_replacement: 'iPad'
+    brand_replacement: 'Apple'
+    model_replacement: 'iPad'
+  - regex: '(iPhone)'
+    device_replacement: 'iPhone'
+    brand_replacement: 'Apple'
+    model_replacement: 'iPhone'
+  - regex: '(iPod)'
+    device_replacement: 'iPod'
+    brand_replacement: 'Apple'
+    model_replacement: 'iPod'
+  - regex: '(Macintosh)'
+    device_replacement: 'Mac'
+    brand_replacement: 'Apple'
+    model_replacement: 'Mac'
+  #android, the model is given before the build id
+  - regex: '; *(SM-[A-Z0-9]+)(?:/\S+)?(?: Build|\))'
+    device_replacement: 'Samsung $1'
+    brand_replacement: 'Samsung'
+    model_replacement: '$1'
+  - regex: '; *(Pixel[^;)]*?)(?: Build|\))'
+    device_replacement: '$1'
+    brand_replacement: 'Google'
+    model_replacement: '$1'
+  - regex: 'Android[^;]*; *(?:[a-z]{2}[-_][a-zA-Z]{2}; *)?([^;)]+?)(?: Build|\))'
+    device_replacement: '$1'
+    brand_replacement: 'Generic_Android'
+    model_replacement: '$1'
+  - regex: '(Android)'
+    device_replacement: 'Generic Smartphone'
+    brand_replacement: 'Generic'
+    model_replacement: 'Smartphone'
+  - regex: '(Windows Phone)'
+    device_replacement: 'Generic Smartphone'
+    brand_replacement: 'Generic'
+    model_replacement: 'Smartphone'
+  - regex: '(?i)(Tablet)'
+    device_replacement: 'Generic Tablet'
+    brand_replacement: 'Generic'
+    model_replacement: 'Tablet'
+`
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "useragent")
+	if err != nil {
+		t.Fatalf("unable to create temp dir : %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	//no regexes file : the bundled ones are used
+	ctx, err := UserAgentInit(map[string]string{"datadir": dir})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	for _, tc := range []struct {
+		ua       string
+		expected map[string]string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.109 Safari/537.36",
+			map[string]string{"UABrowser": "Chrome", "UABrowserVersion": "120.0.6099", "UAOS": "Windows", "UAOSVersion": "10", "UADeviceType": "desktop", "UAIsBot": "false"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			map[string]string{"UABrowser": "Edge", "UABrowserVersion": "120.0.2210", "UAOS": "Windows", "UADeviceType": "desktop"}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+			map[string]string{"UABrowser": "Firefox", "UABrowserVersion": "121.0", "UAOS": "Mac OS X", "UAOSVersion": "10.15", "UADevice": "Mac", "UADeviceType": "desktop"}},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			map[string]string{"UABrowser": "Mobile Safari", "UABrowserVersion": "17.1.2", "UAOS": "iOS", "UAOSVersion": "17.1.2", "UADevice": "iPhone", "UADeviceType": "mobile"}},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			map[string]string{"UAOS": "iOS", "UAOSVersion": "16.6", "UADevice": "iPad", "UADeviceType": "tablet"}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+			map[string]string{"UABrowser": "Chrome Mobile", "UAOS": "Android", "UAOSVersion": "13", "UADevice": "Samsung SM-S918B", "UADeviceBrand": "Samsung", "UADeviceType": "mobile"}},
+		{"Mozilla/5.0 (Linux; Android 12; SM-X200) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Safari/537.36",
+			map[string]string{"UABrowser": "Chrome", "UAOS": "Android", "UADeviceType": "tablet"}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			map[string]string{"UABrowser": "Googlebot", "UABrowserVersion": "2.1", "UADevice": "Spider", "UADeviceType": "bot", "UAIsBot": "true"}},
+		{"Mozilla/5.0 (compatible; SomeNewCrawler/1.0; +http://example.com)",
+			map[string]string{"UABrowser": "SomeNewCrawler", "UABrowserVersion": "1.0", "UADeviceType": "bot", "UAIsBot": "true"}},
+		{"sqlmap/1.7.2#stable (https://sqlmap.org)",
+			map[string]string{"UABrowser": "sqlmap", "UABrowserVersion": "1.7.2", "UAOS": "Other", "UADeviceType": "bot", "UAIsBot": "true"}},
+		{"curl/7.88.1",
+			map[string]string{"UABrowser": "curl", "UABrowserVersion": "7.88.1", "UAIsBot": "true"}},
+		{"Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+			map[string]string{"UABrowser": "IE", "UABrowserVersion": "11.0", "UAOS": "Windows", "UAOSVersion": "7"}},
+		{"-",
+			map[string]string{"UABrowser": "Other", "UABrowserVersion": "", "UAOS": "Other", "UADevice": "Other", "UADeviceType": "other", "UAIsBot": "false"}},
+	} {
+		//twice, the second time from the cache
+		for i := 0; i < 2; i++ {
+			ret, err := ParseUserAgent(tc.ua, nil, ctx)
+			if err != nil {
+				t.Fatalf("%s : unexpected error %s", tc.ua, err)
+			}
+			for k, v := range tc.expected {
+				if ret[k] != v {
+					t.Fatalf("%s : expected %s to be '%s', got '%s' (%+v)", tc.ua, k, v, ret[k], ret)
+				}
+			}
+		}
+	}
+	if ret, err := ParseUserAgent("", nil, ctx); err != nil || len(ret) != 0 {
+		t.Fatalf("expected no enrichment, got %+v (%v)", ret, err)
+	}
+
+	//a regexes file in the data directory replaces the bundled ones, unsupported regexes are skipped
+	regexes := `
+user_agent_parsers:
+  - regex: '(?<=x)Foo'
+  - regex: '(foobrowser)/(\d+)'
+    regex_flag: 'i'
+    family_replacement: 'Foo $1'
+    v2_replacement: 'beta'
+os_parsers:
+  - regex: 'FooOS (\d+)'
+    os_replacement: 'FooOS'
+    os_v1_replacement: '$1'
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, UserAgentFile), []byte(regexes), 0644); err != nil {
+		t.Fatalf("unable to write : %s", err)
+	}
+	ctx, err = UserAgentInit(map[string]string{"datadir": dir, "cache_size": "0"})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	if n := len(ctx.(*UserAgentEnricherCtx).regexes.UserAgent); n != 1 {
+		t.Fatalf("expected 1 user agent parser, got %d", n)
+	}
+	expectUserAgent(t, ctx, "FooBrowser/3 (FooOS 2)", map[string]string{"UABrowser": "Foo FooBrowser", "UABrowserVersion": "3.beta", "UAOS": "FooOS", "UAOSVersion": "2"})
+	expectUserAgent(t, ctx, "Mozilla/5.0 (compatible; Googlebot/2.1)", map[string]string{"UABrowser": "Other", "UAIsBot": "false"})
+
+	//a broken file falls back to the bundled regexes
+	if err := ioutil.WriteFile(filepath.Join(dir, UserAgentFile), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("unable to write : %s", err)
+	}
+	ctx, err = UserAgentInit(map[string]string{"datadir": dir})
+	if err != nil {
+		t.Fatalf("unable to init : %s", err)
+	}
+	expectUserAgent(t, ctx, "Mozilla/5.0 (compatible; Googlebot/2.1)", map[string]string{"UABrowser": "Googlebot", "UAIsBot": "true"})
+
+	for _, cfg := range []map[string]string{
+		{"cache_size": "-1"},
+		{"cache_size": "ratata"},
+	} {
+		if _, err := UserAgentInit(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func expectUserAgent(t *testing.T, ctx interface{}, ua string, expected map[string]string) {
+	ret, err := ParseUserAgent(ua, nil, ctx)
+	if err != nil {
+		t.Fatalf("%s : unexpected error %s", ua, err)
+	}
+	for k, v := range expected {
+		if ret[k] != v {
+			t.Fatalf("%s : expected %s to be '%s', got '%s' (%+v)", ua, k, v, ret[k], ret)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 
 	"github.com/antonmedv/expr"
@@ -11,11 +13,18 @@ import (
 	"github.com/crowdsecurity/crowdsec/pkg/exprhelpers"
 	"github.com/crowdsecurity/crowdsec/pkg/types"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/logrusorgru/grokky"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 )
 
+//ErrDropEvent is returned by a node with 'onfailure: drop' when it fails, the event must be discarded
+var ErrDropEvent = errors.New("event dropped")
+
+//GrokPatternField is the key of Parsed holding the id of the grok pattern that matched, when a grok has several patterns
+const GrokPatternField = "grok_pattern"
+
 type Node struct {
 	FormatVersion string `yaml:"format"`
 	//Enable config + runtime debug of node via config o/
@@ -35,6 +44,8 @@ type Node struct {
 	Stage string `yaml:"stage,omitempty"`
 	//OnSuccess allows to tag a node to be able to move log to next stage on success
 	OnSuccess string `yaml:"onsuccess,omitempty"`
+	//OnFailure allows to move log to next stage, or to drop it, when the node fails
+	OnFailure string `yaml:"onfailure,omitempty"`
 	rn        string //this is only for us in debug, a random generated name for each node
 	//Filter is executed at runtime (with current log line as context)
 	//and must succeed or node is exited
@@ -43,6 +54,8 @@ type Node struct {
 	ExprDebugger  *exprhelpers.ExprDebugger `yaml:"-" json:"-"` //used to debug expression by printing the content of each variable of the expression
 	//If node has leafs, execute all of them until one asks for a 'break'
 	SuccessNodes []Node `yaml:"nodes,omitempty"`
+	//If the node fails, its fallbacks are tried in order until one succeeds
+	FallbackNodes []Node `yaml:"fallback,omitempty"`
 	//Flag used to describe when to 'break' or return an 'error'
 	// BreakBehaviour string `yaml:"break,omitempty"`
 	// Error          string `yaml:"error,omitempty"`
@@ -52,8 +65,14 @@ type Node struct {
 	SubGroks map[string]string `yaml:"pattern_syntax,omitempty"`
 	//Holds a grok pattern
 	Grok types.GrokPattern `yaml:"grok,omitempty"`
+	//Structured logs are decoded as a whole, all their keys go to Parsed
+	JSON *JSONDecoder `yaml:"json,omitempty"`
+	KV   *KVDecoder   `yaml:"kv,omitempty"`
+	CSV  *CSVDecoder  `yaml:"csv,omitempty"`
 	//Statics can be present in any type of node and is executed last
 	Statics []types.ExtraField `yaml:"statics,omitempty"`
+	//Statics applied when the node fails, before the fallbacks
+	FailureStatics []types.ExtraField `yaml:"onfailure_statics,omitempty"`
 	//Whitelists
 	Whitelist types.Whitelist     `yaml:"whitelist,omitempty"`
 	Data      []*types.DataSource `yaml:"data,omitempty"`
@@ -70,46 +89,115 @@ func (n *Node) validate(pctx *UnixParserCtx) error {
 	if n.OnSuccess != "continue" && n.OnSuccess != "next_stage" && n.OnSuccess != "" {
 		return fmt.Errorf("onsuccess '%s' not continue,next_stage", n.OnSuccess)
 	}
+	/* "" behaves like continue as well */
+	if n.OnFailure != "continue" && n.OnFailure != "next_stage" && n.OnFailure != "drop" && n.OnFailure != "" {
+		return fmt.Errorf("onfailure '%s' not continue,next_stage,drop", n.OnFailure)
+	}
 	if n.Filter != "" && n.RunTimeFilter == nil {
 		return fmt.Errorf("non-empty filter '%s' was not compiled", n.Filter)
 	}
 
-	if n.Grok.RunTimeRegexp != nil || n.Grok.TargetField != "" {
+	if n.Grok.RunTimeRegexp != nil || len(n.Grok.Patterns) > 0 || n.Grok.TargetField != "" {
 		if n.Grok.TargetField == "" {
 			return fmt.Errorf("grok's apply_on can't be empty")
 		}
-		if n.Grok.RegexpName == "" && n.Grok.RegexpValue == "" {
-			return fmt.Errorf("grok needs 'pattern' or 'name'")
+		if n.Grok.RegexpName == "" && n.Grok.RegexpValue == "" && len(n.Grok.Patterns) == 0 {
+			return fmt.Errorf("grok needs 'pattern', 'name' or 'patterns'")
+		}
+		if (n.Grok.RegexpName != "" || n.Grok.RegexpValue != "") && len(n.Grok.Patterns) > 0 {
+			return fmt.Errorf("grok's 'patterns' can't be used with 'pattern' or 'name'")
 		}
 	}
 
-	for idx, static := range n.Statics {
+	decoders := 0
+	for _, set := range []bool{n.JSON != nil, n.KV != nil, n.CSV != nil} {
+		if set {
+			decoders++
+		}
+	}
+	if decoders > 1 {
+		return fmt.Errorf("json, kv and csv are mutually exclusive")
+	}
+	if decoder := n.decoder(); decoder != nil && decoder.target() == "" {
+		return fmt.Errorf("apply_on can't be empty")
+	}
+
+	if err := validateStatics(n.Statics); err != nil {
+		return err
+	}
+	if err := validateStatics(n.FailureStatics); err != nil {
+		return fmt.Errorf("onfailure_statics : %s", err)
+	}
+	return nil
+}
+
+func validateStatics(statics []types.ExtraField) error {
+	for idx, static := range statics {
 		if static.Method != "" {
 			if static.ExpValue == "" {
 				return fmt.Errorf("static %d : when method is set, expression must be present", idx)
 			}
-			method_found := false
-			for _, enricherCtx := range ECTX {
-				if _, ok := enricherCtx.Funcs[static.Method]; ok && enricherCtx.initiated {
-					method_found = true
-					break
-				}
+			enricher, _, err := findMethod(static.Method)
+			if err != nil {
+				return fmt.Errorf("static %d : %s", idx, err)
+			}
+			if enricher.Status == ErrEnricherDisabled {
+				return fmt.Errorf("static %d : method '%s' belongs to enricher '%s', which is disabled", idx, static.Method, enricher.Name)
 			}
-			if !method_found {
-				return fmt.Errorf("the method '%s' doesn't exist or the plugin has not been initialized", static.Method)
+			if enricher.Status != nil {
+				log.Warningf("static %d : enricher '%s' isn't initialized, method '%s' will be skipped : %s", idx, enricher.Name, static.Method, enricher.Status)
 			}
 		} else {
-			if static.Meta == "" && static.Parsed == "" && static.TargetByName == "" {
+			if static.Meta == "" && static.Parsed == "" && static.Enriched == "" && static.TargetByName == "" {
 				return fmt.Errorf("static %d : at least one of meta/event/target must be set", idx)
 			}
 			if static.Value == "" && static.RunTimeValue == nil {
 				return fmt.Errorf("static %d value or expression must be set", idx)
 			}
 		}
+		if static.Type != "" {
+			if static.Method != "" || static.TargetByName != "" {
+				return fmt.Errorf("static %d : type can only be set for meta/parsed/enriched", idx)
+			}
+			if !types.IsValueType(static.Type) {
+				return fmt.Errorf("static %d : unknown type '%s' (available : %s)", idx, static.Type, strings.Join(types.ValueTypes, ", "))
+			}
+			if static.Value != "" {
+				if _, err := types.ParseValue(static.Value, static.Type); err != nil {
+					return fmt.Errorf("static %d : value '%s' isn't a %s : %s", idx, static.Value, static.Type, err)
+				}
+			}
+		}
 	}
 	return nil
 }
 
+//decoder returns the structured decoder of the node, if any
+func (n *Node) decoder() structuredDecoder {
+	switch {
+	case n.JSON != nil:
+		return n.JSON
+	case n.KV != nil:
+		return n.KV
+	case n.CSV != nil:
+		return n.CSV
+	}
+	return nil
+}
+
+//matchesFilter tells if the node applies to the event
+func (n *Node) matchesFilter(p *types.Event) bool {
+	if n.RunTimeFilter == nil {
+		return true
+	}
+	output, err := expr.Run(n.RunTimeFilter, exprhelpers.GetExprEnv(map[string]interface{}{"evt": p}))
+	if err != nil {
+		return false
+	}
+	out, ok := output.(bool)
+	return ok && out
+}
+
 func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 	var NodeState bool
 	clog := n.logger
@@ -249,7 +337,7 @@ func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 
 	//Process grok if present, should be exclusive with nodes :)
 	gstr := ""
-	if n.Grok.RunTimeRegexp != nil {
+	if n.Grok.RunTimeRegexp != nil || len(n.Grok.Patterns) > 0 {
 		clog.Tracef("Processing grok pattern : %s : %p", n.Grok.RegexpName, n.Grok.RunTimeRegexp)
 		//for unparsed, parsed etc. set sensible defaults to reduce user hassle
 		if n.Grok.TargetField == "" {
@@ -268,12 +356,25 @@ func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 			}
 		}
 		var groklabel string
-		if n.Grok.RegexpName == "" {
-			groklabel = fmt.Sprintf("%5.5s...", n.Grok.RegexpValue)
+		var grok map[string]string
+		if len(n.Grok.Patterns) > 0 {
+			groklabel = fmt.Sprintf("%d patterns", len(n.Grok.Patterns))
+			//first match wins
+			for _, alt := range n.Grok.Patterns {
+				if grok = alt.RunTimeRegexp.Parse(gstr); len(grok) > 0 {
+					groklabel = alt.ID
+					grok[GrokPatternField] = alt.ID
+					break
+				}
+			}
 		} else {
-			groklabel = n.Grok.RegexpName
+			if n.Grok.RegexpName == "" {
+				groklabel = fmt.Sprintf("%5.5s...", n.Grok.RegexpValue)
+			} else {
+				groklabel = n.Grok.RegexpName
+			}
+			grok = n.Grok.RunTimeRegexp.Parse(gstr)
 		}
-		grok := n.Grok.RunTimeRegexp.Parse(gstr)
 		if len(grok) > 0 {
 			clog.Debugf("+ Grok '%s' returned %d entries to merge in Parsed", groklabel, len(grok))
 			//We managed to grok stuff, merged into parse
@@ -297,13 +398,30 @@ func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 		clog.Tracef("! No grok pattern : %p", n.Grok.RunTimeRegexp)
 	}
 
+	//Process structured decoder if present, after grok so that it can apply on a captured field.
+	//It's skipped when the grok failed, not to leave its keys in Parsed
+	if decoder := n.decoder(); decoder != nil && NodeState {
+		if str, ok := targetValue(p, decoder.target()); !ok {
+			clog.Debugf("(%s) target field '%s' doesn't exist in %v", n.rn, decoder.target(), p.Parsed)
+			NodeState = false
+		} else if parsed, err := decoder.decode(str); err != nil {
+			clog.Debugf("+ failed to decode '%s' : %s", str, err)
+			NodeState = false
+		} else {
+			clog.Debugf("+ Decoder returned %d entries to merge in Parsed", len(parsed))
+			for k, v := range parsed {
+				clog.Debugf("\t.Parsed['%s'] = '%s'", k, v)
+				p.Parsed[k] = v
+			}
+		}
+	}
+
 	//grok or leafs failed, don't process statics
 	if !NodeState {
 		if n.Name != "" {
 			NodesHitsKo.With(prometheus.Labels{"source": p.Line.Src, "name": n.Name}).Inc()
 		}
-		clog.Debugf("Event leaving node : ko")
-		return NodeState, nil
+		return n.processFailure(p, ctx)
 	}
 
 	if n.Name != "" {
@@ -324,14 +442,7 @@ func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 		clog.Debugf("Event leaving node : ok")
 		log.Tracef("node is successful, check strategy")
 		if n.OnSuccess == "next_stage" {
-			idx := stageidx(p.Stage, ctx.Stages)
-			//we're at the last stage
-			if idx+1 == len(ctx.Stages) {
-				clog.Debugf("node reached the last stage : %s", p.Stage)
-			} else {
-				clog.Debugf("move Event from stage %s to %s", p.Stage, ctx.Stages[idx+1])
-				p.Stage = ctx.Stages[idx+1]
-			}
+			n.nextStage(p, ctx)
 		} else {
 			clog.Tracef("no strategy on success (%s), continue !", n.OnSuccess)
 		}
@@ -342,6 +453,137 @@ func (n *Node) process(p *types.Event, ctx UnixParserCtx) (bool, error) {
 	return NodeState, nil
 }
 
+//processFailure handles an event that failed the node : failure statics, then fallbacks, then the onfailure strategy
+func (n *Node) processFailure(p *types.Event, ctx UnixParserCtx) (bool, error) {
+	clog := n.logger
+
+	if len(n.FailureStatics) > 0 {
+		clog.Debugf("+ Processing %d failure statics", len(n.FailureStatics))
+		if err := ProcessStatics(n.FailureStatics, p, clog); err != nil {
+			clog.Fatalf("Failed to process failure statics : %v", err)
+		}
+	}
+	for _, leaf := range n.FallbackNodes {
+		ret, err := leaf.process(p, ctx)
+		if err != nil {
+			clog.Tracef("\tFallback node (%s) failed : %v", leaf.rn, err)
+			return false, err
+		}
+		/* a successful fallback makes the node successful, but its statics don't apply */
+		if ret {
+			clog.Debugf("fallback node (%s) is successful", leaf.rn)
+			clog.Debugf("Event leaving node : ok")
+			if n.OnSuccess == "next_stage" {
+				n.nextStage(p, ctx)
+			}
+			return true, nil
+		}
+	}
+	switch n.OnFailure {
+	case "drop":
+		clog.Debugf("Event leaving node : ko, OnFailure=drop")
+		return false, ErrDropEvent
+	case "next_stage":
+		clog.Debugf("Event leaving node : ko, OnFailure=next_stage")
+		n.nextStage(p, ctx)
+	default:
+		clog.Debugf("Event leaving node : ko")
+	}
+	return false, nil
+}
+
+//nextStage moves the event to the stage following the node's one
+func (n *Node) nextStage(p *types.Event, ctx UnixParserCtx) {
+	idx := stageidx(p.Stage, ctx.Stages)
+	//we're at the last stage
+	if idx+1 == len(ctx.Stages) {
+		n.logger.Debugf("node reached the last stage : %s", p.Stage)
+	} else {
+		n.logger.Debugf("move Event from stage %s to %s", p.Stage, ctx.Stages[idx+1])
+		p.Stage = ctx.Stages[idx+1]
+	}
+}
+
+//compileGrok loads a grok by name or compiles it in-place
+func (n *Node) compileGrok(pctx *UnixParserCtx, name string, value string) (*grokky.Pattern, error) {
+	if name != "" {
+		n.logger.Debugf("+ Regexp Compilation '%s'", name)
+		pattern, err := pctx.Grok.Get(name)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to find grok '%s' : %v", name, err)
+		}
+		if pattern == nil {
+			return nil, fmt.Errorf("Empty grok '%s'", name)
+		}
+		n.logger.Debugf("%s regexp: %s", name, pattern.Regexp.String())
+		return pattern, nil
+	}
+	if strings.HasSuffix(value, "\n") {
+		n.logger.Debugf("Beware, pattern ends with \\n : '%s'", value)
+	}
+	pattern, err := pctx.Grok.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile grok '%s': %v\n", value, err)
+	}
+	if pattern == nil {
+		// We shouldn't be here because compilation succeeded, so regexp shouldn't be nil
+		return nil, fmt.Errorf("Grok compilation failure: %s", value)
+	}
+	n.logger.Debugf("%s regexp : %s", value, pattern.Regexp.String())
+	return pattern, nil
+}
+
+//compileLeaves compiles the child or fallback nodes, that inherit the stage and debug/stats settings
+func (n *Node) compileLeaves(pctx *UnixParserCtx, leaves []Node, kind string) error {
+	for idx := range leaves {
+		if leaves[idx].Name == "" {
+			leaves[idx].Name = fmt.Sprintf("%s-%s", kind, n.Name)
+		}
+		/*propagate debug/stats to child nodes*/
+		if !leaves[idx].Debug && n.Debug {
+			leaves[idx].Debug = true
+		}
+		if !leaves[idx].Profiling && n.Profiling {
+			leaves[idx].Profiling = true
+		}
+		leaves[idx].Stage = n.Stage
+		if err := leaves[idx].compile(pctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ addSubGroks adds the patterns of pattern_syntax. As they can use each other, the ones
+ using a pattern that isn't added yet are retried until no more of them can be added.
+*/
+func (n *Node) addSubGroks(pctx *UnixParserCtx) error {
+	pending := make([]string, 0, len(n.SubGroks))
+	for node := range n.SubGroks {
+		pending = append(pending, node)
+	}
+	sort.Strings(pending)
+	for len(pending) > 0 {
+		var failed []string
+		var lastErr error
+		for _, node := range pending {
+			n.logger.Debugf("Adding subpattern '%s' : '%s'", node, n.SubGroks[node])
+			if err := pctx.Grok.Add(node, n.SubGroks[node]); err != nil {
+				n.logger.Debugf("Unable to add subpattern %s yet : %v", node, err)
+				failed = append(failed, node)
+				lastErr = err
+			}
+		}
+		if len(failed) == len(pending) {
+			n.logger.Errorf("Unable to compile subpattern %s : %v", failed[len(failed)-1], lastErr)
+			return lastErr
+		}
+		pending = failed
+	}
+	return nil
+}
+
 func (n *Node) compile(pctx *UnixParserCtx) error {
 	var err error
 	var valid bool
@@ -393,39 +635,39 @@ func (n *Node) compile(pctx *UnixParserCtx) error {
 	}
 
 	/* handle pattern_syntax and groks */
-	for node, pattern := range n.SubGroks {
-		n.logger.Debugf("Adding subpattern '%s' : '%s'", node, pattern)
-		if err := pctx.Grok.Add(node, pattern); err != nil {
-			n.logger.Errorf("Unable to compile subpattern %s : %v", node, err)
-			return err
-		}
+	if err := n.addSubGroks(pctx); err != nil {
+		return err
 	}
 	/* load grok by name or compile in-place */
-	if n.Grok.RegexpName != "" {
-		n.logger.Debugf("+ Regexp Compilation '%s'", n.Grok.RegexpName)
-		n.Grok.RunTimeRegexp, err = pctx.Grok.Get(n.Grok.RegexpName)
+	if n.Grok.RegexpName != "" || n.Grok.RegexpValue != "" {
+		n.Grok.RunTimeRegexp, err = n.compileGrok(pctx, n.Grok.RegexpName, n.Grok.RegexpValue)
 		if err != nil {
-			return fmt.Errorf("Unable to find grok '%s' : %v", n.Grok.RegexpName, err)
-		}
-		if n.Grok.RunTimeRegexp == nil {
-			return fmt.Errorf("Empty grok '%s'", n.Grok.RegexpName)
+			return err
 		}
-		n.logger.Debugf("%s regexp: %s", n.Grok.RegexpName, n.Grok.RunTimeRegexp.Regexp.String())
 		valid = true
-	} else if n.Grok.RegexpValue != "" {
-		if strings.HasSuffix(n.Grok.RegexpValue, "\n") {
-			n.logger.Debugf("Beware, pattern ends with \\n : '%s'", n.Grok.RegexpValue)
+	}
+	for idx := range n.Grok.Patterns {
+		alt := &n.Grok.Patterns[idx]
+		if alt.RegexpName == "" && alt.RegexpValue == "" {
+			return fmt.Errorf("grok pattern %d needs 'pattern' or 'name'", idx)
 		}
-		//n.logger.Debugf("+ Regexp Compilation '%s'", n.Grok.RegexpValue)
-		n.Grok.RunTimeRegexp, err = pctx.Grok.Compile(n.Grok.RegexpValue)
+		alt.RunTimeRegexp, err = n.compileGrok(pctx, alt.RegexpName, alt.RegexpValue)
 		if err != nil {
-			return fmt.Errorf("Failed to compile grok '%s': %v\n", n.Grok.RegexpValue, err)
+			return err
 		}
-		if n.Grok.RunTimeRegexp == nil {
-			// We shouldn't be here because compilation succeeded, so regexp shouldn't be nil
-			return fmt.Errorf("Grok compilation failure: %s", n.Grok.RegexpValue)
+		if alt.ID == "" {
+			alt.ID = alt.RegexpName
+		}
+		if alt.ID == "" {
+			alt.ID = fmt.Sprintf("%d", idx)
+		}
+		valid = true
+	}
+	/* structured decoders */
+	if decoder := n.decoder(); decoder != nil {
+		if err := decoder.compile(); err != nil {
+			return err
 		}
-		n.logger.Debugf("%s regexp : %s", n.Grok.RegexpValue, n.Grok.RunTimeRegexp.Regexp.String())
 		valid = true
 	}
 	/* load grok statics */
@@ -444,22 +686,14 @@ func (n *Node) compile(pctx *UnixParserCtx) error {
 	}
 	/* compile leafs if present */
 	if len(n.SuccessNodes) > 0 {
-		for idx := range n.SuccessNodes {
-			if n.SuccessNodes[idx].Name == "" {
-				n.SuccessNodes[idx].Name = fmt.Sprintf("child-%s", n.Name)
-			}
-			/*propagate debug/stats to child nodes*/
-			if !n.SuccessNodes[idx].Debug && n.Debug {
-				n.SuccessNodes[idx].Debug = true
-			}
-			if !n.SuccessNodes[idx].Profiling && n.Profiling {
-				n.SuccessNodes[idx].Profiling = true
-			}
-			n.SuccessNodes[idx].Stage = n.Stage
-			err = n.SuccessNodes[idx].compile(pctx)
-			if err != nil {
-				return err
-			}
+		if err := n.compileLeaves(pctx, n.SuccessNodes, "child"); err != nil {
+			return err
+		}
+		valid = true
+	}
+	if len(n.FallbackNodes) > 0 {
+		if err := n.compileLeaves(pctx, n.FallbackNodes, "fallback"); err != nil {
+			return err
 		}
 		valid = true
 	}
@@ -475,6 +709,16 @@ func (n *Node) compile(pctx *UnixParserCtx) error {
 		valid = true
 	}
 
+	for idx := range n.FailureStatics {
+		if n.FailureStatics[idx].ExpValue != "" {
+			n.FailureStatics[idx].RunTimeValue, err = expr.Compile(n.FailureStatics[idx].ExpValue, expr.Env(exprhelpers.GetExprEnv(map[string]interface{}{"evt": &types.Event{}})))
+			if err != nil {
+				n.logger.Errorf("Failure statics Compilation failed %v.", err)
+				return err
+			}
+		}
+	}
+
 	/* compile whitelists if present */
 	for _, v := range n.Whitelist.Ips {
 		n.Whitelist.B_Ips = append(n.Whitelist.B_Ips, net.ParseIP(v))
@@ -33,10 +33,44 @@ func TestParserConfigs(t *testing.T) {
 		{&Node{Debug: true, Stage: "s00", OnSuccess: "ratat", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}}, false, false},
 		//ok node success
 		{&Node{Debug: true, Stage: "s00", OnSuccess: "continue", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}}, true, true},
+		//sub-patterns using each other, whatever their order
+		{&Node{Debug: true, Stage: "s00", SubGroks: map[string]string{"FOODEP": "x%{FOODEPBASE:extr}", "FOODEPBASE": "[a-z]"}, Grok: types.GrokPattern{RegexpValue: "^%{FOODEP}$", TargetField: "t"}}, true, true},
+		//sub-pattern using an unexisting one
+		{&Node{Debug: true, Stage: "s00", SubGroks: map[string]string{"FOOMISSING": "x%{RATATA:extr}"}}, false, true},
 		//valid node with grok sub-pattern used by name
 		{&Node{Debug: true, Stage: "s00", SubGroks: map[string]string{"FOOBARx": "[a-z] %{DATA:lol}$"}, Grok: types.GrokPattern{RegexpName: "FOOBARx", TargetField: "t"}}, true, true},
 		//node with unexisting grok pattern
 		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpName: "RATATA", TargetField: "t"}}, false, true},
+		//valid node with a list of grok patterns
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{Patterns: []types.GrokAlternative{{RegexpValue: "^x%{DATA:extr}$"}, {RegexpName: "FOOBARx"}}, TargetField: "t"}}, true, true},
+		//list of grok patterns with an empty or unexisting pattern
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{Patterns: []types.GrokAlternative{{RegexpValue: "^x%{DATA:extr}$"}, {}}, TargetField: "t"}}, false, true},
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{Patterns: []types.GrokAlternative{{RegexpName: "RATATA"}}, TargetField: "t"}}, false, true},
+		//list of grok patterns along with a pattern
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", Patterns: []types.GrokAlternative{{RegexpValue: "^y%{DATA:extr}$"}}, TargetField: "t"}}, false, false},
+		//onfailure strategies and failure statics
+		{&Node{Debug: true, Stage: "s00", OnFailure: "drop", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}}, true, true},
+		{&Node{Debug: true, Stage: "s00", OnFailure: "ratat", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}}, false, false},
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}, FailureStatics: []types.ExtraField{{Parsed: "failed", Value: "true"}}}, true, true},
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}, FailureStatics: []types.ExtraField{{Value: "true"}}}, false, false},
+		//typed statics
+		{&Node{Debug: true, Stage: "s00", Statics: []types.ExtraField{{Parsed: "status", ExpValue: "evt.Parsed.status", Type: "int"}, {Enriched: "tags", Value: "a,b", Type: "list"}}}, true, true},
+		{&Node{Debug: true, Stage: "s00", Statics: []types.ExtraField{{Parsed: "status", ExpValue: "evt.Parsed.status", Type: "ratata"}}}, false, false},
+		{&Node{Debug: true, Stage: "s00", Statics: []types.ExtraField{{Parsed: "status", Value: "abc", Type: "int"}}}, false, false},
+		{&Node{Debug: true, Stage: "s00", Statics: []types.ExtraField{{TargetByName: "evt.Stage", Value: "s01", Type: "string"}}}, false, false},
+		{&Node{Debug: true, Stage: "s00", Statics: []types.ExtraField{{Method: "ParseDate", ExpValue: "evt.Parsed.date", Type: "time"}}}, false, false},
+		//fallback nodes must be valid
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}, FallbackNodes: []Node{{Grok: types.GrokPattern{RegexpValue: "^y%{DATA:extr}$", TargetField: "t"}}}}, true, true},
+		{&Node{Debug: true, Stage: "s00", Grok: types.GrokPattern{RegexpValue: "^x%{DATA:extr}$", TargetField: "t"}, FallbackNodes: []Node{{Grok: types.GrokPattern{RegexpValue: "^y%{DATA:extr}$"}}}}, false, true},
+		//valid structured nodes
+		{&Node{Debug: true, Stage: "s00", JSON: &JSONDecoder{TargetField: "Line.Raw"}}, true, true},
+		{&Node{Debug: true, Stage: "s00", CSV: &CSVDecoder{TargetField: "t", Fields: []string{"a", "", "b"}}}, true, true},
+		//structured nodes without target, fields, or with a bad quote
+		{&Node{Debug: true, Stage: "s00", JSON: &JSONDecoder{}}, false, false},
+		{&Node{Debug: true, Stage: "s00", CSV: &CSVDecoder{TargetField: "t"}}, false, true},
+		{&Node{Debug: true, Stage: "s00", KV: &KVDecoder{TargetField: "t", Quote: "''"}}, false, true},
+		//structured nodes are exclusive
+		{&Node{Debug: true, Stage: "s00", JSON: &JSONDecoder{TargetField: "t"}, KV: &KVDecoder{TargetField: "t"}}, false, false},
 
 		//bad grok pattern
 		//{&Node{Debug: true, Grok: []GrokPattern{ GrokPattern{}, }}, false},
@@ -2,15 +2,20 @@ package parser
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/crowdsecurity/crowdsec/pkg/exprhelpers"
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
 	"github.com/crowdsecurity/crowdsec/pkg/types"
 	"github.com/davecgh/go-spew/spew"
 	log "github.com/sirupsen/logrus"
@@ -147,12 +152,10 @@ func prepTests() (*UnixParserCtx, error) {
 
 	//Load enrichment
 	datadir := "../../data/"
-	pplugins, err := Loadplugin(datadir)
+	ECTX, err = LoadEnrichers(csconfig.EnrichersConfig{}, datadir)
 	if err != nil {
-		log.Fatalf("failed to load plugin geoip : %v", err)
+		log.Fatalf("failed to load enrichers : %v", err)
 	}
-	ECTX = nil
-	ECTX = append(ECTX, pplugins)
 	log.Printf("Loaded -> %+v", ECTX)
 
 	//Load the parser patterns
@@ -347,3 +350,205 @@ func testFile(testSet []TestFile, pctx UnixParserCtx, nodes []Node) bool {
 	}
 	return true
 }
+
+func TestParseTrace(t *testing.T) {
+	pctx, err := prepTests()
+	if err != nil {
+		t.Fatalf("failed to load env : %s", err)
+	}
+	nodes, err := LoadStages([]Stagefile{
+		{Filename: "./tests/onfailure/base-grok.yaml", Stage: "s00-raw"},
+		{Filename: "./tests/onfailure/base-grok2.yaml", Stage: "s01-parse"},
+	}, pctx)
+	if err != nil {
+		t.Fatalf("unable to load parser config : %s", err)
+	}
+	ParseDump = true
+	defer func() { ParseDump = false }()
+
+	evt := types.Event{Line: types.Line{Raw: "yyheader VALUE2", Labels: map[string]string{"type": "testlog"}}}
+	if _, err := Parse(*pctx, evt, nodes); err != nil {
+		t.Fatalf("failed to parse : %s", err)
+	}
+	var matched []NodeTrace
+	for _, trace := range ParseTrace {
+		if trace.FilterMatched {
+			matched = append(matched, trace)
+		}
+	}
+	if len(matched) != 2 {
+		t.Fatalf("expected 2 matching nodes, got %d : %+v", len(matched), ParseTrace)
+	}
+	if matched[0].Stage != "s00-raw" || matched[0].Node != "tests/onfailure-next-stage" || !matched[0].Success {
+		t.Fatalf("unexpected trace %+v", matched[0])
+	}
+	//the event is the one left by the node
+	if matched[0].Event.Parsed["parsed_by"] != "fallback" || matched[0].Event.Meta["log_type"] != "" {
+		t.Fatalf("unexpected event after %s : %+v", matched[0].Node, matched[0].Event)
+	}
+	if matched[1].Stage != "s01-parse" || matched[1].Node != "tests/onfailure-s01" || !matched[1].Success {
+		t.Fatalf("unexpected trace %+v", matched[1])
+	}
+	if matched[1].Event.Meta["log_type"] != "parsed_testlog" {
+		t.Fatalf("unexpected event after %s : %+v", matched[1].Node, matched[1].Event)
+	}
+
+	evt = types.Event{Line: types.Line{Raw: "drop this", Labels: map[string]string{"type": "droplog"}}}
+	if _, err := Parse(*pctx, evt, nodes); err != nil {
+		t.Fatalf("failed to parse : %s", err)
+	}
+	last := ParseTrace[len(ParseTrace)-1]
+	if last.Node != "tests/onfailure-drop" || !last.FilterMatched || last.Success || !last.Dropped {
+		t.Fatalf("unexpected trace %+v", last)
+	}
+}
+
+func TestDecoderAfterFailedGrok(t *testing.T) {
+	pctx, err := prepTests()
+	if err != nil {
+		t.Fatalf("failed to load env : %s", err)
+	}
+	nodes, err := LoadStages([]Stagefile{{Filename: "./tests/structured-nodes/structured.yaml", Stage: "s00-raw"}}, pctx)
+	if err != nil {
+		t.Fatalf("unable to load parser config : %s", err)
+	}
+	ParseDump = true
+	defer func() { ParseDump = false }()
+
+	evt := types.Event{Line: types.Line{Raw: `{"level": "info", "msg": "hello"}`, Labels: map[string]string{"type": "json-2"}}}
+	if _, err := Parse(*pctx, evt, nodes); err != nil {
+		t.Fatalf("failed to parse : %s", err)
+	}
+	for _, trace := range ParseTrace {
+		if trace.Node != "tests/grok-json-node" {
+			continue
+		}
+		//the grok failed, the json isn't decoded
+		if trace.Success || len(trace.Event.Parsed) != 0 {
+			t.Fatalf("unexpected trace %+v", trace)
+		}
+		return
+	}
+	t.Fatalf("node not found in %+v", ParseTrace)
+}
+
+func TestTypedStatics(t *testing.T) {
+	pctx, err := prepTests()
+	if err != nil {
+		t.Fatalf("failed to load env : %s", err)
+	}
+	nodes, err := LoadStages([]Stagefile{{Filename: "./tests/typed-statics/base-grok.yaml", Stage: "s00-raw"}}, pctx)
+	if err != nil {
+		t.Fatalf("unable to load parser config : %s", err)
+	}
+	evt := types.Event{Line: types.Line{Raw: "2001:DB8::0001 404 1.5", Labels: map[string]string{"type": "weblog"}}}
+	out, err := Parse(*pctx, evt, nodes)
+	if err != nil {
+		t.Fatalf("failed to parse : %s", err)
+	}
+	if out.Typed == nil {
+		t.Fatalf("expected typed entries")
+	}
+	expected := map[string]interface{}{
+		"Parsed.status":       404,
+		"Parsed.latency":      1.5,
+		"Meta.source_ip":      net.ParseIP("2001:db8::1"),
+		"Meta.slow":           true,
+		"Meta.tags":           []string{"web", "api"},
+		"Enriched.latency_ms": 1500,
+	}
+	natives := map[string]map[string]interface{}{"Parsed": out.Typed.Parsed, "Meta": out.Typed.Meta, "Enriched": out.Typed.Enriched}
+	for name, value := range expected {
+		section, key := strings.SplitN(name, ".", 2)[0], strings.SplitN(name, ".", 2)[1]
+		if !reflect.DeepEqual(natives[section][key], value) {
+			t.Fatalf("%s : expected %#v, got %#v", name, value, natives[section][key])
+		}
+		if out.Typed.Types[name] == "" {
+			t.Fatalf("%s : expected a type in %+v", name, out.Typed.Types)
+		}
+	}
+	if _, ok := out.Typed.Meta["is_error"]; ok {
+		t.Fatalf("untyped entries aren't in Typed")
+	}
+
+	//events with typed entries can be cloned, and the types survive serialization
+	var clone types.Event
+	if err := types.Clone(&out, &clone); err != nil {
+		t.Fatalf("unable to clone : %s", err)
+	}
+	if !reflect.DeepEqual(clone.Typed.Meta["source_ip"], expected["Meta.source_ip"]) {
+		t.Fatalf("unexpected clone %+v", clone.Typed)
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("unable to marshal : %s", err)
+	}
+	var restored types.Event
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("unable to unmarshal : %s", err)
+	}
+	restored.RefreshTyped()
+	if restored.Typed.Parsed["status"] != 404 || !reflect.DeepEqual(restored.Typed.Meta["tags"], expected["Meta.tags"]) {
+		t.Fatalf("unexpected restored event %+v", restored.Typed)
+	}
+
+	//the native values follow their string form, and are dropped when it isn't of their type anymore
+	out.Parsed["status"] = "500"
+	out.Parsed["latency"] = "slow"
+	out.RefreshTyped()
+	if out.Typed.Parsed["status"] != 500 {
+		t.Fatalf("expected the status to be refreshed, got %#v", out.Typed.Parsed["status"])
+	}
+	if _, ok := out.Typed.Parsed["latency"]; ok || out.Typed.Types["Parsed.latency"] != "" {
+		t.Fatalf("expected the latency to lose its type")
+	}
+
+	//events without typed entries have empty sections, so that expressions can check for an entry
+	evt = types.Event{Line: types.Line{Raw: "nothing", Labels: map[string]string{"type": "otherlog"}}}
+	if out, err = Parse(*pctx, evt, nodes); err != nil || out.Typed == nil || out.Typed.Parsed == nil || out.Typed.Meta == nil ||
+		out.Typed.Enriched == nil || len(out.Typed.Types) != 0 {
+		t.Fatalf("unexpected typed entries %+v (%v)", out.Typed, err)
+	}
+	//they share their empty sections, until an entry is typed
+	other, err := Parse(*pctx, evt, nodes)
+	if err != nil || other.Typed != out.Typed {
+		t.Fatalf("expected the empty sections to be shared (%v)", err)
+	}
+	if err := other.SetTyped("Parsed", "status", "404", types.IntType); err != nil {
+		t.Fatalf("unable to set status : %s", err)
+	}
+	if other.Typed == out.Typed || len(out.Typed.Parsed) != 0 || other.Typed.Parsed["status"] != 404 {
+		t.Fatalf("unexpected typed entries %+v and %+v", out.Typed, other.Typed)
+	}
+}
+
+func TestSetTargetByName(t *testing.T) {
+	evt := types.Event{Parsed: map[string]string{}}
+	for _, tc := range []struct {
+		target string
+		value  string
+		ok     bool
+	}{
+		{"evt.Parsed.foo", "bar", true},
+		{"evt.Stage", "s01-parse", true},
+		{"evt.Whitelisted", "true", true},
+		{"evt.Overflow.Capacity", "42", true},
+		{"evt.Overflow.Source_Latitude", "1.5", true},
+		{"evt.Overflow.Leak_speed", "10s", true},
+		{"evt.Time", "2020-01-02T03:04:05Z", true},
+		{"evt.Whitelisted", "ratata", false},
+		{"evt.Overflow.Capacity", "1.5", false},
+		{"evt.Time", "yesterday", false},
+		{"evt.Overflow.Sources", "foo", false},
+		{"evt.Nope", "foo", false},
+	} {
+		if ok := SetTargetByName(tc.target, tc.value, &evt); ok != tc.ok {
+			t.Fatalf("%s = '%s' : expected %t, got %t", tc.target, tc.value, tc.ok, ok)
+		}
+	}
+	if evt.Parsed["foo"] != "bar" || evt.Stage != "s01-parse" || !evt.Whitelisted || evt.Overflow.Capacity != 42 ||
+		evt.Overflow.Source_Latitude != 1.5 || evt.Overflow.Leak_speed != 10*time.Second ||
+		!evt.Time.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("unexpected event %+v", evt)
+	}
+}
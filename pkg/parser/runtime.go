@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/crowdsecurity/crowdsec/pkg/exprhelpers"
 	"github.com/crowdsecurity/crowdsec/pkg/types"
@@ -88,14 +89,64 @@ func SetTargetByName(target string, value string, evt *types.Event) bool {
 		log.Errorf("'%s' can't be set", target)
 		return false
 	}
-	if iter.Kind() != reflect.String {
-		log.Errorf("Expected string, got %v when handling '%s'", iter.Kind(), target)
+	if err := setFromString(iter, value); err != nil {
+		log.Errorf("unable to set '%s' to '%s' : %s", target, value, err)
 		return false
 	}
-	iter.Set(reflect.ValueOf(value))
 	return true
 }
 
+//setFromString sets v to value, converted to the type of v
+func setFromString(v reflect.Value, value string) error {
+	switch v.Interface().(type) {
+	case time.Time:
+		t, err := types.ParseValue(value, types.TimeType)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
 func printStaticTarget(static types.ExtraField) string {
 
 	if static.Method != "" {
@@ -120,8 +171,10 @@ func ProcessStatics(statics []types.ExtraField, p *types.Event, clog *logrus.Ent
 
 	for _, static := range statics {
 		value = ""
+		var native interface{} //the value before it's converted to a string, for typed statics
 		if static.Value != "" {
 			value = static.Value
+			native = value
 		} else if static.RunTimeValue != nil {
 			output, err := expr.Run(static.RunTimeValue, exprhelpers.GetExprEnv(map[string]interface{}{"evt": p}))
 			if err != nil {
@@ -133,10 +186,16 @@ func ProcessStatics(statics []types.ExtraField, p *types.Event, clog *logrus.Ent
 				value = out
 			case int:
 				value = strconv.Itoa(out)
+			case nil:
+				//ie. a missing entry of evt.Typed
 			default:
-				clog.Fatalf("unexpected return type for RunTimeValue : %T", output)
-				return errors.New("unexpected return type for RunTimeValue")
+				//the native values (float, bool, time, ip, list ...) are converted to their string form
+				if value, err = types.FormatValue(output); err != nil {
+					clog.Fatalf("unexpected return type for RunTimeValue : %T", output)
+					return errors.New("unexpected return type for RunTimeValue")
+				}
 			}
+			native = output
 		}
 
 		if value == "" {
@@ -145,32 +204,44 @@ func ProcessStatics(statics []types.ExtraField, p *types.Event, clog *logrus.Ent
 		}
 
 		if static.Method != "" {
-			processed := false
 			/*still way too hackish, but : inject all the results in enriched, and */
-			for _, x := range ECTX {
-				if fptr, ok := x.Funcs[static.Method]; ok && x.initiated {
-					clog.Tracef("Found method '%s'", static.Method)
-					ret, err := fptr(value, p, x.RuntimeCtx)
-					if err != nil {
-						clog.Fatalf("plugin function error : %v", err)
-					}
-					processed = true
-					clog.Debugf("+ Method %s('%s') returned %d entries to merge in .Enriched\n", static.Method, value, len(ret))
-					if len(ret) == 0 {
-						clog.Debugf("+ Method '%s' empty response on '%s'", static.Method, value)
-					}
-					for k, v := range ret {
-						clog.Debugf("\t.Enriched[%s] = '%s'\n", k, v)
-						p.Enriched[k] = v
-					}
-					break
-				} else {
-					clog.Warningf("method '%s' doesn't exist or plugin not initialized", static.Method)
-				}
+			enricher, fptr, err := findMethod(static.Method)
+			if err != nil {
+				clog.Warningf("%s", err)
+				continue
 			}
-			if !processed {
-				clog.Warningf("method '%s' doesn't exist", static.Method)
+			if !enricher.initiated {
+				clog.Debugf("enricher '%s' isn't initialized, skip method '%s'", enricher.Name, static.Method)
+				continue
+			}
+			clog.Tracef("Found method '%s'", static.Method)
+			ret, err := fptr(value, p, enricher.RuntimeCtx)
+			//a failing lookup only costs the event its enrichment
+			if err != nil {
+				EnricherErrors.With(prometheus.Labels{"name": enricher.Name}).Inc()
+				clog.Warningf("method '%s' failed on '%s' : %v", static.Method, value, err)
+				continue
+			}
+			clog.Debugf("+ Method %s('%s') returned %d entries to merge in .Enriched\n", static.Method, value, len(ret))
+			if len(ret) == 0 {
+				clog.Debugf("+ Method '%s' empty response on '%s'", static.Method, value)
+			}
+			for k, v := range ret {
+				clog.Debugf("\t.Enriched[%s] = '%s'\n", k, v)
+				p.Enriched[k] = v
+			}
+		} else if static.Type != "" {
+			section, key := "Parsed", static.Parsed
+			if static.Meta != "" {
+				section, key = "Meta", static.Meta
+			} else if static.Enriched != "" {
+				section, key = "Enriched", static.Enriched
+			}
+			if err := p.SetTyped(section, key, native, static.Type); err != nil {
+				clog.Warningf("unable to set %s to '%s' : not a %s : %s", printStaticTarget(static), value, static.Type, err)
+				continue
 			}
+			clog.Debugf(".%s[%s] = '%s' (%s)", section, key, value, static.Type)
 		} else if static.Parsed != "" {
 			clog.Debugf(".Parsed[%s] = '%s'", static.Parsed, value)
 			p.Parsed[static.Parsed] = value
@@ -227,9 +298,22 @@ func stageidx(stage string, stages []string) int {
 	return -1
 }
 
+//ParseDump makes Parse keep a copy of the event after each node, in StageParseCache (successful nodes only) and ParseTrace
 var ParseDump bool
 var StageParseCache map[string]map[string]types.Event
 
+//NodeTrace is the outcome of a node on an event
+type NodeTrace struct {
+	Stage         string
+	Node          string
+	FilterMatched bool //false if the node doesn't apply to the event
+	Success       bool
+	Dropped       bool        //the node failed with onfailure: drop
+	Event         types.Event //the event as the node left it
+}
+
+var ParseTrace []NodeTrace
+
 func /*(u types.UnixParser)*/ Parse(ctx UnixParserCtx, xp types.Event, nodes []Node) (types.Event, error) {
 	var event types.Event = xp
 
@@ -249,12 +333,15 @@ func /*(u types.UnixParser)*/ Parse(ctx UnixParserCtx, xp types.Event, nodes []N
 	if event.Meta == nil {
 		event.Meta = make(map[string]string)
 	}
+	//so that the filters can refer to evt.Typed before any entry is typed
+	event.InitTyped()
 	if event.Type == types.LOG {
 		log.Tracef("INPUT '%s'", event.Line.Raw)
 	}
 
 	if ParseDump {
 		StageParseCache = make(map[string]map[string]types.Event)
+		ParseTrace = nil
 	}
 
 	for _, stage := range ctx.Stages {
@@ -289,7 +376,27 @@ func /*(u types.UnixParser)*/ Parse(ctx UnixParserCtx, xp types.Event, nodes []N
 			if ctx.Profiling {
 				node.Profiling = true
 			}
+			filterMatched := false
+			if ParseDump {
+				filterMatched = node.matchesFilter(&event)
+			}
 			ret, err := node.process(&event, ctx)
+			//once some entries are typed, they follow the changes of their string form
+			if event.HasTyped() {
+				event.RefreshTyped()
+			}
+			if ParseDump {
+				trace := NodeTrace{Stage: stage, Node: node.Name, FilterMatched: filterMatched, Success: ret, Dropped: err == ErrDropEvent}
+				if err := types.Clone(&event, &trace.Event); err != nil {
+					log.Fatalf("while cloning Event in parser : %s", err)
+				}
+				ParseTrace = append(ParseTrace, trace)
+			}
+			if err == ErrDropEvent {
+				clog.Debugf("node dropped the event")
+				event.Process = false
+				return event, nil
+			}
 			if err != nil {
 				clog.Fatalf("Error while processing node : %v", err)
 			}
@@ -314,7 +421,8 @@ func /*(u types.UnixParser)*/ Parse(ctx UnixParserCtx, xp types.Event, nodes []N
 				break
 			}
 		}
-		if !isStageOK {
+		//a node that failed with onfailure: next_stage passes the event to next stage as well
+		if !isStageOK && event.Stage == stage {
 			log.Debugf("Log didn't finish stage %s", event.Stage)
 			event.Process = false
 			return event, nil
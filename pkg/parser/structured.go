@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+)
+
+/*
+ Structured node kinds (json, kv and csv) decode a whole field of the event
+ and merge all the keys they find into evt.Parsed, without grok nor statics.
+*/
+type structuredDecoder interface {
+	//checks the configuration and sets the defaults
+	compile() error
+	//the field the decoder applies to
+	target() string
+	decode(string) (map[string]string, error)
+}
+
+//JSONDecoder flattens a json object, nested keys are joined with Separator
+type JSONDecoder struct {
+	TargetField string `yaml:"apply_on,omitempty"`
+	Prefix      string `yaml:"prefix,omitempty"`
+	Separator   string `yaml:"separator,omitempty"`
+}
+
+//KVDecoder parses key=value pairs (logfmt style)
+type KVDecoder struct {
+	TargetField string `yaml:"apply_on,omitempty"`
+	Prefix      string `yaml:"prefix,omitempty"`
+	//what separates the pairs
+	Delimiter string `yaml:"delimiter,omitempty"`
+	//what separates the key from the value
+	Separator string `yaml:"separator,omitempty"`
+	Quote     string `yaml:"quote,omitempty"`
+}
+
+//CSVDecoder maps the columns of a delimited line to Fields (an empty name skips the column)
+type CSVDecoder struct {
+	TargetField string   `yaml:"apply_on,omitempty"`
+	Prefix      string   `yaml:"prefix,omitempty"`
+	Fields      []string `yaml:"fields,omitempty"`
+	Delimiter   string   `yaml:"delimiter,omitempty"`
+	Quote       string   `yaml:"quote,omitempty"`
+}
+
+//targetValue returns the content of the field a grok or a decoder applies to
+func targetValue(p *types.Event, field string) (string, bool) {
+	//it's a hack to avoid using real reflect
+	if field == "Line.Raw" {
+		return p.Line.Raw, true
+	}
+	val, ok := p.Parsed[field]
+	return val, ok
+}
+
+func checkQuote(quote string) error {
+	if len(quote) > 1 {
+		return fmt.Errorf("quote must be a single character, got '%s'", quote)
+	}
+	return nil
+}
+
+func (d *JSONDecoder) compile() error {
+	if d.TargetField == "" {
+		return fmt.Errorf("json's apply_on can't be empty")
+	}
+	if d.Separator == "" {
+		d.Separator = "."
+	}
+	return nil
+}
+
+func (d *JSONDecoder) target() string {
+	return d.TargetField
+}
+
+func (d *JSONDecoder) decode(s string) (map[string]string, error) {
+	var obj map[string]interface{}
+
+	dec := json.NewDecoder(strings.NewReader(s))
+	//keep numbers as they were written
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid json object : %s", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("trailing data after the json object")
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("not a json object")
+	}
+	ret := make(map[string]string)
+	if err := d.flatten(ret, d.Prefix, obj); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (d *JSONDecoder) flatten(ret map[string]string, prefix string, obj map[string]interface{}) error {
+	for k, v := range obj {
+		key := prefix + k
+		switch val := v.(type) {
+		case map[string]interface{}:
+			if err := d.flatten(ret, key+d.Separator, val); err != nil {
+				return err
+			}
+		case string:
+			ret[key] = val
+		case json.Number:
+			ret[key] = val.String()
+		case bool:
+			ret[key] = fmt.Sprintf("%t", val)
+		case nil:
+			ret[key] = ""
+		default:
+			//arrays are kept as json, just like JsonExtract does
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(val); err != nil {
+				return fmt.Errorf("while encoding '%s' : %s", key, err)
+			}
+			ret[key] = strings.TrimSuffix(buf.String(), "\n")
+		}
+	}
+	return nil
+}
+
+func (d *KVDecoder) compile() error {
+	if d.TargetField == "" {
+		return fmt.Errorf("kv's apply_on can't be empty")
+	}
+	if d.Delimiter == "" {
+		d.Delimiter = " "
+	}
+	if d.Separator == "" {
+		d.Separator = "="
+	}
+	if d.Quote == "" {
+		d.Quote = `"`
+	}
+	return checkQuote(d.Quote)
+}
+
+func (d *KVDecoder) target() string {
+	return d.TargetField
+}
+
+func (d *KVDecoder) decode(s string) (map[string]string, error) {
+	pairs, err := splitQuoted(s, d.Delimiter, d.Quote[0])
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string)
+	for _, pair := range pairs {
+		//consecutive delimiters
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, d.Separator, 2)
+		if len(kv) != 2 || kv[0] == "" {
+			continue
+		}
+		ret[d.Prefix+kv[0]] = kv[1]
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no key%svalue pair found", d.Separator)
+	}
+	return ret, nil
+}
+
+func (d *CSVDecoder) compile() error {
+	if d.TargetField == "" {
+		return fmt.Errorf("csv's apply_on can't be empty")
+	}
+	if len(d.Fields) == 0 {
+		return fmt.Errorf("csv needs 'fields'")
+	}
+	if d.Delimiter == "" {
+		d.Delimiter = ","
+	}
+	if d.Quote == "" {
+		d.Quote = `"`
+	}
+	return checkQuote(d.Quote)
+}
+
+func (d *CSVDecoder) target() string {
+	return d.TargetField
+}
+
+func (d *CSVDecoder) decode(s string) (map[string]string, error) {
+	columns, err := splitQuoted(s, d.Delimiter, d.Quote[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != len(d.Fields) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(d.Fields), len(columns))
+	}
+	ret := make(map[string]string)
+	for idx, name := range d.Fields {
+		if name == "" {
+			continue
+		}
+		ret[d.Prefix+name] = columns[idx]
+	}
+	return ret, nil
+}
+
+/*
+ splitQuoted splits s on delim, except within quotes. The quotes are removed,
+ and a quote can be escaped within quotes by doubling it or with a backslash.
+*/
+func splitQuoted(s string, delim string, quote byte) ([]string, error) {
+	var ret []string
+	var cur strings.Builder
+
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(s) && (s[i+1] == quote || s[i+1] == '\\'):
+			i++
+			cur.WriteByte(s[i])
+		case quoted && c == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+			cur.WriteByte(quote)
+		case c == quote:
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(s[i:], delim):
+			ret = append(ret, cur.String())
+			cur.Reset()
+			i += len(delim) - 1
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	return append(ret, cur.String()), nil
+}
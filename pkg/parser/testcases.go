@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	"gopkg.in/yaml.v2"
+)
+
+//ParserTestCase is a sample line, and what the parsers are expected to make of it
+type ParserTestCase struct {
+	Name     string            `yaml:"name,omitempty"`
+	Line     string            `yaml:"line"`
+	Source   string            `yaml:"source,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+	Expected ParserTestExpect  `yaml:"expected"`
+}
+
+//ParserTestExpect is the expected outcome of a test case, only the fields present are checked
+type ParserTestExpect struct {
+	//the line is expected to be parsed, unless set to false
+	Process     *bool             `yaml:"process,omitempty"`
+	Whitelisted bool              `yaml:"whitelisted,omitempty"`
+	Stage       string            `yaml:"stage,omitempty"` //the stage the event ends in
+	Parsed      map[string]string `yaml:"parsed,omitempty"`
+	Meta        map[string]string `yaml:"meta,omitempty"`
+	Enriched    map[string]string `yaml:"enriched,omitempty"`
+	Types       map[string]string `yaml:"types,omitempty"` //the type of the typed entries (ie. Parsed.status: int)
+}
+
+//ParserTestResult lists the differences between the expected and actual outcome of a test case
+type ParserTestResult struct {
+	Name  string   `json:"name"`
+	Diffs []string `json:"diffs,omitempty"`
+}
+
+func (r ParserTestResult) Success() bool {
+	return len(r.Diffs) == 0
+}
+
+//LoadParserTests reads a yaml file holding a list of test cases
+func LoadParserTests(file string) ([]ParserTestCase, error) {
+	var tests []ParserTestCase
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("while reading %s : %s", file, err)
+	}
+	if err := yaml.UnmarshalStrict(data, &tests); err != nil {
+		return nil, fmt.Errorf("while parsing %s : %s", file, err)
+	}
+	for idx := range tests {
+		if tests[idx].Name == "" {
+			tests[idx].Name = fmt.Sprintf("line %d", idx+1)
+		}
+		if tests[idx].Line == "" {
+			return nil, fmt.Errorf("%s : test '%s' has no line", file, tests[idx].Name)
+		}
+	}
+	return tests, nil
+}
+
+//RunParserTest parses the line of the test case with nodes, and compares the event to the expected one
+func RunParserTest(ctx UnixParserCtx, nodes []Node, test ParserTestCase) (ParserTestResult, error) {
+	result := ParserTestResult{Name: test.Name}
+
+	evt := types.Event{
+		Type:    types.LOG,
+		Process: true,
+		Line: types.Line{
+			Raw:     test.Line,
+			Src:     test.Source,
+			Labels:  test.Labels,
+			Process: true,
+		},
+	}
+	parsed, err := Parse(ctx, evt, nodes)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse '%s' : %s", test.Line, err)
+	}
+
+	expectProcess := test.Expected.Process == nil || *test.Expected.Process
+	if parsed.Process != expectProcess {
+		result.Diffs = append(result.Diffs, fmt.Sprintf("process : expected %t, got %t (stopped at stage %s)", expectProcess, parsed.Process, parsed.Stage))
+	}
+	if parsed.Whitelisted != test.Expected.Whitelisted {
+		result.Diffs = append(result.Diffs, fmt.Sprintf("whitelisted : expected %t, got %t", test.Expected.Whitelisted, parsed.Whitelisted))
+	}
+	if test.Expected.Stage != "" && parsed.Stage != test.Expected.Stage {
+		result.Diffs = append(result.Diffs, fmt.Sprintf("stage : expected '%s', got '%s'", test.Expected.Stage, parsed.Stage))
+	}
+	result.Diffs = append(result.Diffs, diffMap("Parsed", test.Expected.Parsed, parsed.Parsed)...)
+	result.Diffs = append(result.Diffs, diffMap("Meta", test.Expected.Meta, parsed.Meta)...)
+	result.Diffs = append(result.Diffs, diffMap("Enriched", test.Expected.Enriched, parsed.Enriched)...)
+	var actualTypes map[string]string
+	if parsed.Typed != nil {
+		actualTypes = parsed.Typed.Types
+	}
+	result.Diffs = append(result.Diffs, diffMap("Types", test.Expected.Types, actualTypes)...)
+	return result, nil
+}
+
+func diffMap(label string, expected map[string]string, actual map[string]string) []string {
+	var diffs []string
+
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		val, ok := actual[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s[%s] : expected '%s', missing", label, k, expected[k]))
+		} else if val != expected[k] {
+			diffs = append(diffs, fmt.Sprintf("%s[%s] : expected '%s', got '%s'", label, k, expected[k], val))
+		}
+	}
+	return diffs
+}
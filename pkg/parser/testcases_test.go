@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParserTestCases(t *testing.T) {
+	pctx, err := prepTests()
+	if err != nil {
+		t.Fatalf("failed to load env : %s", err)
+	}
+	nodes, err := LoadStages([]Stagefile{{Filename: "./tests/base-grok/base-grok.yaml", Stage: "s00-raw"}}, pctx)
+	if err != nil {
+		t.Fatalf("unable to load parser config : %s", err)
+	}
+	tests, err := LoadParserTests("./tests/base-grok/testcases.yaml")
+	if err != nil {
+		t.Fatalf("unable to load test cases : %s", err)
+	}
+
+	expected := []ParserTestResult{
+		{Name: "header and trailer"},
+		{Name: "line 2", Diffs: []string{
+			"Parsed[extracted_value] : expected 'VALUE1', got 'VALUE2'",
+			"Meta[log_type] : expected 'other', got 'parsed_testlog'",
+			"Meta[missing] : expected 'value', missing",
+			"Types[Parsed.extracted_value] : expected 'int', missing",
+		}},
+		{Name: "unhandled type label"},
+	}
+	if len(tests) != len(expected) {
+		t.Fatalf("expected %d test cases, got %d", len(expected), len(tests))
+	}
+	for idx, test := range tests {
+		result, err := RunParserTest(*pctx, nodes, test)
+		if err != nil {
+			t.Fatalf("%s : %s", test.Name, err)
+		}
+		if !reflect.DeepEqual(result, expected[idx]) {
+			t.Fatalf("expected %+v, got %+v", expected[idx], result)
+		}
+	}
+
+	if _, err := LoadParserTests("./tests/base-grok/parsers.yaml"); err == nil {
+		t.Fatalf("expected error on invalid test file")
+	}
+}
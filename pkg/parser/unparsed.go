@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type UnparsedLine struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Type   string    `json:"type,omitempty"`
+	Stage  string    `json:"stage"` //the stage the line didn't get through
+	Raw    string    `json:"raw"`
+}
+
+//UnparsedSink stores a sample of the lines that failed to be parsed, to help finding the log formats the parsers miss
+type UnparsedSink struct {
+	sampling int
+	lock     sync.Mutex
+	//by source, at most maxSources of them : the least recently seen one is dropped to make room for a new one
+	sources    map[string]*unparsedSource
+	maxSources int
+	adds       uint64 //ticks of the sources' lastSeen
+	//file mode
+	output io.WriteCloser
+	//memory mode
+	size int
+}
+
+type unparsedSource struct {
+	seen     uint64 //unparsed lines seen
+	lastSeen uint64
+	//memory mode, the ring of the last lines
+	lines []UnparsedLine
+	next  int
+}
+
+func NewUnparsedSink(cfg csconfig.UnparsedConfig) (*UnparsedSink, error) {
+	if cfg.Sampling < 0 {
+		return nil, fmt.Errorf("sampling can't be negative")
+	}
+	if cfg.MaxSources < 0 {
+		return nil, fmt.Errorf("max_sources can't be negative")
+	}
+	sink := &UnparsedSink{sampling: cfg.Sampling, maxSources: cfg.MaxSources, sources: make(map[string]*unparsedSource)}
+	if sink.sampling == 0 {
+		sink.sampling = 1
+	}
+	if sink.maxSources == 0 {
+		sink.maxSources = 1000
+	}
+	switch cfg.Mode {
+	case csconfig.UNPARSEDFILE:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("unparsed lines sink needs a path in %s mode", csconfig.UNPARSEDFILE)
+		}
+		if cfg.MaxSize == 0 {
+			cfg.MaxSize = 100
+		}
+		if cfg.MaxBackups == 0 {
+			cfg.MaxBackups = 3
+		}
+		sink.output = &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSize,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   true,
+		}
+	case csconfig.UNPARSEDMEMORY:
+		if cfg.Size < 0 {
+			return nil, fmt.Errorf("size can't be negative")
+		}
+		//not on the prometheus listener, as the raw lines can hold sensitive data
+		if cfg.Listen == "" {
+			return nil, fmt.Errorf("unparsed lines sink needs a listen address in %s mode", csconfig.UNPARSEDMEMORY)
+		}
+		sink.size = cfg.Size
+		if sink.size == 0 {
+			sink.size = 100
+		}
+	default:
+		return nil, fmt.Errorf("unknown unparsed lines sink mode '%s' (expected %s or %s)", cfg.Mode, csconfig.UNPARSEDFILE, csconfig.UNPARSEDMEMORY)
+	}
+	return sink, nil
+}
+
+//Add stores the line of the event, if it's sampled. stage is the one the event didn't get through
+func (s *UnparsedSink) Add(evt types.Event, stage string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	src := s.source(evt.Line.Src)
+	src.seen++
+	if (src.seen-1)%uint64(s.sampling) != 0 {
+		return
+	}
+	line := UnparsedLine{
+		Time:   time.Now(),
+		Source: evt.Line.Src,
+		Type:   evt.Line.Labels["type"],
+		Stage:  stage,
+		Raw:    evt.Line.Raw,
+	}
+	if s.output != nil {
+		data, err := json.Marshal(line)
+		if err != nil {
+			log.Warningf("unparsed lines : failed to marshal line : %s", err)
+			return
+		}
+		if _, err := s.output.Write(append(data, '\n')); err != nil {
+			log.Warningf("unparsed lines : failed to write line : %s", err)
+		}
+		return
+	}
+	if len(src.lines) < s.size {
+		src.lines = append(src.lines, line)
+		return
+	}
+	src.lines[src.next] = line
+	src.next = (src.next + 1) % s.size
+}
+
+//source returns the state of name, and drops the least recently seen source if there are too many of them
+func (s *UnparsedSink) source(name string) *unparsedSource {
+	src, ok := s.sources[name]
+	if !ok {
+		if len(s.sources) >= s.maxSources {
+			var oldest string
+			for n, o := range s.sources {
+				if oldest == "" || o.lastSeen < s.sources[oldest].lastSeen {
+					oldest = n
+				}
+			}
+			log.Debugf("unparsed lines : too many sources, dropping %s", oldest)
+			delete(s.sources, oldest)
+		}
+		src = &unparsedSource{}
+		s.sources[name] = src
+	}
+	s.adds++
+	src.lastSeen = s.adds
+	return src
+}
+
+//Lines returns the lines kept in memory, from the oldest to the most recent. All sources are returned if source is empty
+func (s *UnparsedSink) Lines(source string) []UnparsedLine {
+	var ret []UnparsedLine
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sources := make([]string, 0, len(s.sources))
+	for src := range s.sources {
+		if source == "" || source == src {
+			sources = append(sources, src)
+		}
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		ring := s.sources[src]
+		ret = append(ret, ring.lines[ring.next:]...)
+		ret = append(ret, ring.lines[:ring.next]...)
+	}
+	return ret
+}
+
+//ServeHTTP serves the lines kept in memory as json, optionally filtered by the source parameter
+func (s *UnparsedSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lines := s.Lines(r.URL.Query().Get("source"))
+	if lines == nil {
+		lines = []UnparsedLine{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lines); err != nil {
+		log.Warningf("unparsed lines : failed to send lines : %s", err)
+	}
+}
+
+func (s *UnparsedSink) Close() error {
+	if s.output != nil {
+		return s.output.Close()
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/crowdsecurity/crowdsec/pkg/csconfig"
+	"github.com/crowdsecurity/crowdsec/pkg/types"
+)
+
+func unparsedEvent(src string, raw string) types.Event {
+	return types.Event{Line: types.Line{Src: src, Raw: raw, Labels: map[string]string{"type": "syslog"}}}
+}
+
+func TestUnparsedSinkConfig(t *testing.T) {
+	for idx, cfg := range []csconfig.UnparsedConfig{
+		{},
+		{Mode: "ratata"},
+		{Mode: csconfig.UNPARSEDFILE},
+		{Mode: csconfig.UNPARSEDMEMORY, Sampling: -1},
+		{Mode: csconfig.UNPARSEDMEMORY, Size: -1, Listen: "127.0.0.1:6061"},
+		{Mode: csconfig.UNPARSEDMEMORY},
+		{Mode: csconfig.UNPARSEDMEMORY, MaxSources: -1, Listen: "127.0.0.1:6061"},
+	} {
+		if _, err := NewUnparsedSink(cfg); err == nil {
+			t.Fatalf("%d : expected error for %+v", idx, cfg)
+		}
+	}
+}
+
+func TestUnparsedSinkMemory(t *testing.T) {
+	sink, err := NewUnparsedSink(csconfig.UnparsedConfig{Mode: csconfig.UNPARSEDMEMORY, Size: 3, Sampling: 2, Listen: "127.0.0.1:6061"})
+	if err != nil {
+		t.Fatalf("unable to create sink : %s", err)
+	}
+	//one line out of two is kept, and only the last 3 of them
+	for i := 0; i < 10; i++ {
+		sink.Add(unparsedEvent("/var/log/a.log", fmt.Sprintf("line %d", i)), "s01-parse")
+	}
+	sink.Add(unparsedEvent("/var/log/b.log", "other line"), "s00-raw")
+
+	lines := sink.Lines("/var/log/a.log")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	for idx, expected := range []string{"line 4", "line 6", "line 8"} {
+		if lines[idx].Raw != expected {
+			t.Fatalf("expected '%s', got '%s'", expected, lines[idx].Raw)
+		}
+		if lines[idx].Stage != "s01-parse" || lines[idx].Type != "syslog" {
+			t.Fatalf("unexpected line %+v", lines[idx])
+		}
+	}
+
+	ts := httptest.NewServer(sink)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "?source=/var/log/b.log")
+	if err != nil {
+		t.Fatalf("request failed : %s", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&lines); err != nil {
+		t.Fatalf("invalid response : %s", err)
+	}
+	if len(lines) != 1 || lines[0].Raw != "other line" || lines[0].Stage != "s00-raw" {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+	if len(sink.Lines("")) != 4 {
+		t.Fatalf("expected 4 lines for all sources, got %d", len(sink.Lines("")))
+	}
+}
+
+func TestUnparsedSinkMaxSources(t *testing.T) {
+	sink, err := NewUnparsedSink(csconfig.UnparsedConfig{Mode: csconfig.UNPARSEDMEMORY, MaxSources: 2, Listen: "127.0.0.1:6061"})
+	if err != nil {
+		t.Fatalf("unable to create sink : %s", err)
+	}
+	sink.Add(unparsedEvent("/var/log/a.log", "a"), "s01-parse")
+	sink.Add(unparsedEvent("/var/log/b.log", "b"), "s01-parse")
+	sink.Add(unparsedEvent("/var/log/a.log", "a again"), "s01-parse")
+	//b is the least recently seen
+	sink.Add(unparsedEvent("/var/log/c.log", "c"), "s01-parse")
+	if len(sink.Lines("/var/log/b.log")) != 0 {
+		t.Fatalf("expected b to be dropped")
+	}
+	if len(sink.Lines("/var/log/a.log")) != 2 || len(sink.Lines("/var/log/c.log")) != 1 {
+		t.Fatalf("unexpected lines %+v", sink.Lines(""))
+	}
+}
+
+func TestUnparsedSinkFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unparsed")
+	if err != nil {
+		t.Fatalf("unable to create temp dir : %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewUnparsedSink(csconfig.UnparsedConfig{Mode: csconfig.UNPARSEDFILE, Path: dir + "/unparsed.log", Sampling: 3})
+	if err != nil {
+		t.Fatalf("unable to create sink : %s", err)
+	}
+	for i := 0; i < 6; i++ {
+		sink.Add(unparsedEvent("/var/log/a.log", fmt.Sprintf("line %d", i)), "s01-parse")
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("unable to close sink : %s", err)
+	}
+	fd, err := os.Open(dir + "/unparsed.log")
+	if err != nil {
+		t.Fatalf("unable to open output : %s", err)
+	}
+	defer fd.Close()
+	var raws []string
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		var line UnparsedLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid line '%s' : %s", scanner.Text(), err)
+		}
+		raws = append(raws, line.Raw)
+	}
+	if len(raws) != 2 || raws[0] != "line 0" || raws[1] != "line 3" {
+		t.Fatalf("unexpected lines %v", raws)
+	}
+}
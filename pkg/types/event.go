@@ -32,4 +32,6 @@ type Event struct {
 	Process       bool            `yaml:"Process,omitempty"` //can be set to false to avoid processing line
 	/* Meta is the only part that will make it to the API - it should be normalized */
 	Meta map[string]string `json:"Meta,omitempty" yaml:"Meta,omitempty"`
+	/* native values of the typed entries of Parsed, Enriched and Meta, allocated along with the first one (see InitTyped) */
+	Typed *TypedFields `json:"Typed,omitempty" yaml:"Typed,omitempty"`
 }
@@ -22,6 +22,8 @@ type ExtraField struct {
 	RunTimeValue *vm.Program `json:"-"` //the actual compiled filter
 	//or an enrichment method
 	Method string `yaml:"method,omitempty"`
+	//the type of the value for parsed/meta/enriched (string by default), its native value is set in the Typed section of the event
+	Type string `yaml:"type,omitempty"`
 }
 
 type GrokPattern struct {
@@ -33,6 +35,20 @@ type GrokPattern struct {
 	RegexpValue string `yaml:"pattern,omitempty"`
 	//the runtime form of regexpname / regexpvalue
 	RunTimeRegexp *grokky.Pattern `json:"-"` //the actual regexp
+	//or a list of patterns, tried in order until one matches
+	Patterns []GrokAlternative `yaml:"patterns,omitempty"`
 	//a grok can contain statics that apply if pattern is successfull
 	Statics []ExtraField `yaml:"statics,omitempty"`
 }
+
+//One of the patterns of a grok
+type GrokAlternative struct {
+	//how the pattern is reported when it matches (defaults to its name or position)
+	ID string `yaml:"id,omitempty"`
+	//the grok/regexp by name (loaded from patterns/*)
+	RegexpName string `yaml:"name,omitempty"`
+	//a proper grok pattern
+	RegexpValue string `yaml:"pattern,omitempty"`
+	//the runtime form of regexpname / regexpvalue
+	RunTimeRegexp *grokky.Pattern `json:"-"` //the actual regexp
+}
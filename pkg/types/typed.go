@@ -0,0 +1,274 @@
+package types
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//the types a static can give to an entry of Parsed, Enriched or Meta
+const (
+	StringType = "string"
+	IntType    = "int"
+	FloatType  = "float"
+	BoolType   = "bool"
+	TimeType   = "time"
+	IPType     = "ip"
+	ListType   = "list"
+)
+
+var ValueTypes = []string{StringType, IntType, FloatType, BoolType, TimeType, IPType, ListType}
+
+/*
+ TypedFields are the native values of the typed entries of Parsed, Enriched and Meta, so that expressions
+ can use them as such (ie. evt.Typed.Parsed.status >= 400). The string maps stay the reference : the native
+ values are derived from them, and only the types are serialized. The sections are empty, not nil, when nothing is typed.
+*/
+type TypedFields struct {
+	Parsed   map[string]interface{} `json:"-" yaml:"-"`
+	Enriched map[string]interface{} `json:"-" yaml:"-"`
+	Meta     map[string]interface{} `json:"-" yaml:"-"`
+	//the type of each typed entry, by section and key (ie. "Parsed.status" : "int")
+	Types map[string]string `json:"Types,omitempty" yaml:"Types,omitempty"`
+	//the string form the native values were derived from
+	raw map[string]string
+}
+
+func init() {
+	//so that events with typed entries can be cloned
+	gob.Register(time.Time{})
+	gob.Register(net.IP{})
+	gob.Register([]string{})
+}
+
+func IsValueType(typ string) bool {
+	for _, t := range ValueTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+//ParseValue returns the native value of s as typ
+func ParseValue(s string, typ string) (interface{}, error) {
+	switch typ {
+	case StringType, "":
+		return s, nil
+	case IntType:
+		return strconv.Atoi(strings.TrimSpace(s))
+	case FloatType:
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case BoolType:
+		return strconv.ParseBool(strings.TrimSpace(s))
+	case TimeType:
+		//RFC3339, or a unix timestamp
+		s = strings.TrimSpace(s)
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t, nil
+		}
+		if ts, err := strconv.ParseFloat(s, 64); err == nil {
+			sec := int64(ts)
+			return time.Unix(sec, int64((ts-float64(sec))*1e9)).UTC(), nil
+		}
+		return nil, fmt.Errorf("invalid time '%s', expected RFC3339 or a unix timestamp", s)
+	case IPType:
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip '%s'", s)
+		}
+		return ip, nil
+	case ListType:
+		ret := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				ret = append(ret, item)
+			}
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", typ)
+	}
+}
+
+//FormatValue returns the string form of a native value, as stored in Parsed, Enriched and Meta
+func FormatValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case int:
+		return strconv.Itoa(val), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case int32:
+		return strconv.FormatInt(int64(val), 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case time.Time:
+		return val.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return val.String(), nil
+	case net.IP:
+		return val.String(), nil
+	case []string:
+		return strings.Join(val, ","), nil
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			s, err := FormatValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+//ConvertValue converts a native value (ie. returned by an expression) to typ
+func ConvertValue(v interface{}, typ string) (interface{}, error) {
+	s, err := FormatValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return ParseValue(s, typ)
+}
+
+//emptyTypedFields is shared by the events without typed entries, so that they don't allocate anything : it must not be written to
+var emptyTypedFields = &TypedFields{
+	Parsed:   map[string]interface{}{},
+	Enriched: map[string]interface{}{},
+	Meta:     map[string]interface{}{},
+}
+
+//InitTyped makes sure evt.Typed and its sections can be used in expressions, even if no entry is typed
+func (e *Event) InitTyped() {
+	if e.Typed == nil {
+		e.Typed = emptyTypedFields
+	}
+}
+
+//HasTyped tells if some entries of the event are typed
+func (e *Event) HasTyped() bool {
+	return e.Typed != nil && len(e.Typed.Types) > 0
+}
+
+//sections returns the string and native maps of section (Parsed, Enriched or Meta)
+func (e *Event) sections(section string) (map[string]string, map[string]interface{}, error) {
+	//the first typed entry of the event
+	if e.Typed == nil || e.Typed == emptyTypedFields {
+		e.Typed = &TypedFields{}
+	}
+	if e.Typed.Parsed == nil {
+		e.Typed.Parsed = make(map[string]interface{})
+	}
+	if e.Typed.Enriched == nil {
+		e.Typed.Enriched = make(map[string]interface{})
+	}
+	if e.Typed.Meta == nil {
+		e.Typed.Meta = make(map[string]interface{})
+	}
+	switch section {
+	case "Parsed":
+		if e.Parsed == nil {
+			e.Parsed = make(map[string]string)
+		}
+		return e.Parsed, e.Typed.Parsed, nil
+	case "Enriched":
+		if e.Enriched == nil {
+			e.Enriched = make(map[string]string)
+		}
+		return e.Enriched, e.Typed.Enriched, nil
+	case "Meta":
+		if e.Meta == nil {
+			e.Meta = make(map[string]string)
+		}
+		return e.Meta, e.Typed.Meta, nil
+	}
+	return nil, nil, fmt.Errorf("unknown section '%s'", section)
+}
+
+//SetTyped converts value to typ, and sets it as key of section (Parsed, Enriched or Meta), along with its string form
+func (e *Event) SetTyped(section string, key string, value interface{}, typ string) error {
+	native, err := ConvertValue(value, typ)
+	if err != nil {
+		return err
+	}
+	str, err := FormatValue(native)
+	if err != nil {
+		return err
+	}
+	strMap, nativeMap, err := e.sections(section)
+	if err != nil {
+		return err
+	}
+	if e.Typed.Types == nil {
+		e.Typed.Types = make(map[string]string)
+		e.Typed.raw = make(map[string]string)
+	} else if e.Typed.raw == nil {
+		e.Typed.raw = make(map[string]string)
+	}
+	strMap[key] = str
+	nativeMap[key] = native
+	e.Typed.Types[section+"."+key] = typ
+	e.Typed.raw[section+"."+key] = str
+	return nil
+}
+
+/*
+ RefreshTyped derives again the native values whose string form changed (ie. overwritten by a grok pattern,
+ or after the event was unmarshaled). An entry whose string form was removed, or isn't of its type anymore, loses its type.
+*/
+func (e *Event) RefreshTyped() {
+	e.InitTyped()
+	if !e.HasTyped() {
+		return
+	}
+	if e.Typed.raw == nil {
+		e.Typed.raw = make(map[string]string)
+	}
+	for name, typ := range e.Typed.Types {
+		idx := strings.Index(name, ".")
+		if idx < 0 {
+			delete(e.Typed.Types, name)
+			continue
+		}
+		section, key := name[:idx], name[idx+1:]
+		strMap, nativeMap, err := e.sections(section)
+		if err != nil {
+			delete(e.Typed.Types, name)
+			continue
+		}
+		str, ok := strMap[key]
+		if raw, seen := e.Typed.raw[name]; ok && seen && raw == str {
+			if _, hasNative := nativeMap[key]; hasNative {
+				continue
+			}
+		}
+		var native interface{}
+		if ok {
+			native, err = ParseValue(str, typ)
+		}
+		if !ok || err != nil {
+			delete(e.Typed.Types, name)
+			delete(e.Typed.raw, name)
+			delete(nativeMap, key)
+			continue
+		}
+		nativeMap[key] = native
+		e.Typed.raw[name] = str
+	}
+}